@@ -0,0 +1,121 @@
+package answers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/pterm/pterm"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+/* Answer holds the values we would otherwise prompt for */
+type Answer struct {
+	Version string `yaml:"version,omitempty"`
+	Summary string `yaml:"summary,omitempty"`
+}
+
+type answersFile struct {
+	Answers map[string]Answer `yaml:"answers"`
+}
+
+var (
+	mu       sync.Mutex
+	loaded   string
+	file     map[string]Answer
+	loaderr  error
+	provided = make(map[string]Answer)
+)
+
+/* Provide sets the answer for a recipe, as given on the command line. It
+ * takes precedence over the answers file */
+func Provide(identifier string, a Answer) {
+	mu.Lock()
+	defer mu.Unlock()
+	provided[identifier] = a
+}
+
+/* Interactive reports if we may prompt. Prompts are off with
+ * --non-interactive, and when running in CI */
+func Interactive() bool {
+	return !viper.GetBool("answers.noninteractive") && os.Getenv("CI") == ""
+}
+
+/* load reads the answers file, once per file name */
+func load() (map[string]Answer, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	name := viper.GetString("answers.file")
+	if name == loaded {
+		return file, loaderr
+	}
+	loaded = name
+	file, loaderr = nil, nil
+	if name == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		utils.Logger.Error("Failed to read answers file", utils.Logger.Args("file", name, "error", err))
+		loaderr = err
+		return nil, err
+	}
+	var af answersFile
+	if err := yaml.Unmarshal(raw, &af); err != nil {
+		utils.Logger.Error("Failed to unmarshal answers file", utils.Logger.Args("file", name, "error", err))
+		loaderr = err
+		return nil, err
+	}
+	file = af.Answers
+	return file, nil
+}
+
+/* Get returns the answer for a recipe, from the command line or else the
+ * answers file */
+func Get(identifier string) (Answer, error) {
+	answers, err := load()
+	if err != nil {
+		return Answer{}, err
+	}
+	mu.Lock()
+	a := provided[identifier]
+	mu.Unlock()
+	if fa, ok := answers[identifier]; ok {
+		if a.Version == "" {
+			a.Version = fa.Version
+		}
+		if a.Summary == "" {
+			a.Summary = fa.Summary
+		}
+	}
+	return a, nil
+}
+
+/* Ask resolves a value that was not answered up front. When interactive
+ * the user is prompted, otherwise the fallback is used. A value that is
+ * still missing is an error, never a blocking prompt */
+func Ask(identifier string, what string, interactive bool, fallback func() (string, error)) (string, error) {
+	if interactive {
+		result, err := pterm.DefaultInteractiveTextInput.WithMultiLine(false).Show(what + " for " + identifier)
+		if err != nil {
+			return "", err
+		}
+		if result = strings.TrimSpace(result); result != "" {
+			return result, nil
+		}
+	}
+	if fallback != nil {
+		if value, err := fallback(); err == nil && value != "" {
+			utils.Logger.Info("Using fallback", utils.Logger.Args("recipe", identifier, "value", what, "fallback", value))
+			return value, nil
+		}
+	}
+	if !interactive {
+		return "", fmt.Errorf("no %s for %s: give it with --%s or an answers file", strings.ToLower(what), identifier, strings.ToLower(what))
+	}
+	return "", errors.New("no " + strings.ToLower(what) + " for " + identifier)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	"github.com/Fishwaldo/go-yocto/backends/kde"
+	"github.com/Fishwaldo/go-yocto/searchindex"
 	"github.com/Fishwaldo/go-yocto/source"
 	"github.com/Fishwaldo/go-yocto/utils"
 )
@@ -14,13 +15,22 @@ type Backend interface {
 	Init() error
 	LoadCache() error
 	LoadSource() error
-	SearchSource(keyword string) (source []source.RecipeSource, err error)
-	GetRecipe(identifier string) (*source.RecipeSource, error)	
+	SearchSource(q source.Query) (matches []source.Match, err error)
+	SearchDocuments() ([]source.Document, error)
+	Details(identifier string) (*source.Details, error)
+	FetchDetails(d *source.Details) error
+	GetRecipe(identifier string, opts source.Options) (*source.RecipeSource, error)
+	GetRecipeVersion(identifier string, version string, opts source.Options) (*source.RecipeSource, error)
+	LatestVersion(identifier string) (string, error)
+	Releases(identifier string) ([]source.Release, error)
+	ListRecipes(pattern string) ([]string, error)
 	Ready() bool
 }
 
 var Backends map[string]Backend
 
+var cacheLoaded bool
+
 func init() {
 	Backends = make(map[string]Backend)
 	Backends["kde"] = kde.NewBackend()
@@ -39,6 +49,7 @@ func Init() (err error) {
 
 func LoadCache() (err error) {
 	utils.Logger.Trace("Loading Cache")
+	cacheLoaded = true
 	for _, be := range Backends {
 		if be.Ready() {
 			if err := be.LoadCache(); err != nil {
@@ -51,6 +62,15 @@ func LoadCache() (err error) {
 	return nil
 }
 
+/* loadCacheOnce loads the caches for commands that skipped them at start
+ * up, as search does when it has an index */
+func loadCacheOnce() error {
+	if cacheLoaded {
+		return nil
+	}
+	return LoadCache()
+}
+
 func LoadSource() (err error) {
 	utils.Logger.Trace("Loading Source")
 	for _, be := range Backends {
@@ -62,29 +82,85 @@ func LoadSource() (err error) {
 			utils.Logger.Trace("LoadSource: Backend not ready", utils.Logger.Args("backend", be.GetName()))
 		}
 	}
-	return nil
+	return BuildSearchIndex()
 }
 
-func SearchSource(be string, keyword string) (sources []source.RecipeSource, err error) {
-	utils.Logger.Trace("Searching Source")
-	for _, be := range Backends {
+/* SearchSource searches the index built by cache update, or if there is
+ * none the backends themselves, and returns the ranked matches. The query
+ * may name a backend by its key or its name */
+func SearchSource(q source.Query) (matches []source.Match, err error) {
+	utils.Logger.Trace("Searching Source", utils.Logger.Args("keywords", q.Keywords, "backend", q.Backend))
+	switch q.Sort {
+	case "", source.SortScore, source.SortName, source.SortIdentifier, source.SortBackend:
+	default:
+		return nil, errors.New("unknown sort " + q.Sort + ", use score, name, identifier or backend")
+	}
+	var search []Backend
+	for name, be := range Backends {
+		if q.Backend == "" || name == q.Backend || be.GetName() == q.Backend {
+			search = append(search, be)
+		}
+	}
+	if len(search) == 0 {
+		utils.Logger.Error("Backend not found", utils.Logger.Args("backend", q.Backend))
+		return nil, errors.New("backend not found")
+	}
+	if q.Backend != "" {
+		q.Backend = search[0].GetName()
+	}
+
+	ix, err := searchindex.Load(searchindex.File())
+	if err == nil {
+		return q.Rank(ix.Search(q)), nil
+	}
+	utils.Logger.Warn("Searching without the search index", utils.Logger.Args("error", err))
+	if err := loadCacheOnce(); err != nil {
+		return nil, err
+	}
+	for _, be := range search {
 		if be.Ready() {
-			if source, err := be.SearchSource(keyword); err != nil {
+			if m, err := be.SearchSource(q); err != nil {
 				utils.Logger.Error("Failed to Search Source", utils.Logger.Args("backend", be.GetName(), "error", err))
 			} else {
-				sources = append(sources, source...)
+				matches = append(matches, m...)
 			}
 		} else {
 			utils.Logger.Trace("SearchSource: Backend not ready", utils.Logger.Args("backend", be.GetName()))
 		}
 	}
-	return sources, nil
+	return q.Rank(matches), nil
+}
+
+/* BuildSearchIndex feeds the sources of every backend to the search index
+ * and writes it to disk */
+func BuildSearchIndex() error {
+	utils.Logger.Trace("Building Search Index")
+	var docs []source.Document
+	for _, be := range Backends {
+		if !be.Ready() {
+			utils.Logger.Trace("BuildSearchIndex: Backend not ready", utils.Logger.Args("backend", be.GetName()))
+			continue
+		}
+		d, err := be.SearchDocuments()
+		if err != nil {
+			utils.Logger.Error("Failed to get Search Documents", utils.Logger.Args("backend", be.GetName(), "error", err))
+			return err
+		}
+		docs = append(docs, d...)
+	}
+	ix := searchindex.Build(docs)
+	if err := ix.Save(searchindex.File()); err != nil {
+		utils.Logger.Error("Failed to save Search Index", utils.Logger.Args("file", searchindex.File(), "error", err))
+		return err
+	}
+	utils.Logger.Info("Built Search Index", utils.Logger.Args("sources", len(ix.Entries), "terms", len(ix.Terms)))
+	return nil
 }
 
-func GetRecipe(be string, identifier string) (source *source.RecipeSource, err error) {
+func GetRecipe(be string, identifier string, opts source.Options) (source *source.RecipeSource, err error) {
 	utils.Logger.Trace("Getting Recipe", utils.Logger.Args("backend", be, "identifier", identifier))
 	if be, ok := Backends[be]; ok {
-		if source, err := be.GetRecipe(identifier); err != nil {
+		if source, err := be.GetRecipe(identifier, opts); err != nil {
 			utils.Logger.Error("Failed to Get Recipe", utils.Logger.Args("backend", be.GetName(), "identifier", identifier, "error", err))
 			return nil, errors.New("Failed to Get Recipe")
 		} else {
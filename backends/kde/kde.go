@@ -5,21 +5,26 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	//	"fmt"
 
+	"github.com/Fishwaldo/go-yocto/answers"
 	"github.com/Fishwaldo/go-yocto/parsers"
 	"github.com/Fishwaldo/go-yocto/repo"
 	"github.com/Fishwaldo/go-yocto/source"
 	"github.com/Fishwaldo/go-yocto/utils"
 
+	"github.com/Masterminds/semver/v3"
 	"golang.org/x/exp/maps"
 
 	"github.com/pterm/pterm"
@@ -299,21 +304,63 @@ func (l *KDEBe) LoadCache() (err error) {
 	return nil
 }
 
-func (l *KDEBe) SearchSource(keywords string) (source []source.RecipeSource, err error) {
-	utils.Logger.Trace("Searching KDE Source", utils.Logger.Args("keyword", keywords))
+/* SearchSource ranks the projects against a query, over their name,
+ * identifier, topics, AppStream summary and description */
+func (l *KDEBe) SearchSource(q source.Query) (matches []source.Match, err error) {
+	utils.Logger.Trace("Searching KDE Source", utils.Logger.Args("keyword", q.Keywords))
 
 	p, _ := pterm.DefaultProgressbar.WithTotal(len(l.pr)).WithTitle("Searching KDE...").Start()
 
 	for _, data := range l.pr {
 		p.Increment()
-		if strings.Contains(strings.ToLower(data.Name), strings.ToLower(keywords)) {
-			source = append(source, data.RecipeSource)
+		d := searchDocument(data)
+		if score, ok := q.Score(d); ok {
+			matches = append(matches, source.Match{Source: d.Source, Score: score})
 		}
-		if strings.Contains(strings.ToLower(data.Description), strings.ToLower(keywords)) {
-			source = append(source, data.RecipeSource)
+	}
+	return matches, nil
+}
+
+/* SearchDocuments feeds every project to the search index */
+func (l *KDEBe) SearchDocuments() (docs []source.Document, err error) {
+	for _, data := range l.pr {
+		docs = append(docs, searchDocument(data))
+	}
+	return docs, nil
+}
+
+/* searchDocument is what we search of a project. Its section is the
+ * top of the repopath and its groups add the release group */
+func searchDocument(data Project) source.Document {
+	d := source.Document{Source: data.RecipeSource, Topics: data.Topics, Active: data.Repoactive}
+	d.Source.Section = path.Dir(data.Repopath)
+	if group, ok := GetReleaseGroup(data.Identifier); ok {
+		d.Groups = append(d.Groups, group)
+	}
+	if as, ok := data.MetaData["appstream"]; ok {
+		if summary, ok := as["summary"].(string); ok {
+			d.Summary = summary
+		}
+	}
+	return d
+}
+
+/* ListRecipes returns the identifiers whose repopath or identifier match
+ * the glob pattern, eg frameworks/* */
+func (l *KDEBe) ListRecipes(pattern string) (identifiers []string, err error) {
+	utils.Logger.Trace("Listing KDE Recipes", utils.Logger.Args("pattern", pattern))
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	for id, data := range l.pr {
+		if ok, _ := filepath.Match(pattern, data.Repopath); ok {
+			identifiers = append(identifiers, id)
+		} else if ok, _ := filepath.Match(pattern, id); ok {
+			identifiers = append(identifiers, id)
 		}
 	}
-	return source, nil;
+	sort.Strings(identifiers)
+	return identifiers, nil
 }
 
 func findmetdata(path string) (files []string) {
@@ -331,27 +378,81 @@ func findmetdata(path string) (files []string) {
     return files
 }
 
-func (l *KDEBe) GetRecipe(identifier string) (*source.RecipeSource, error) {
-	utils.Logger.Trace("Getting KDE Recipe", utils.Logger.Args("recipe", identifier))
+func (l *KDEBe) GetRecipe(identifier string, opts source.Options) (*source.RecipeSource, error) {
+	return l.GetRecipeVersion(identifier, "", opts)
+}
+
+/* GetRecipeVersion returns the recipe for a specific version. An empty
+ * version picks the answered, release set or AppStream version */
+func (l *KDEBe) GetRecipeVersion(identifier string, version string, opts source.Options) (*source.RecipeSource, error) {
+	utils.Logger.Trace("Getting KDE Recipe", utils.Logger.Args("recipe", identifier, "version", version))
 	if recipe, ok := l.pr[identifier]; ok {
 
+		answer, err := answers.Get(identifier)
+		if err != nil {
+			return nil, err
+		}
+		if version == "" {
+			version = answer.Version
+		}
+		/* the version may be a constraint, eg ~5.104, for the newest
+		 * tarball that satisfies it */
+		if source.IsConstraint(version) {
+			r, err := source.SelectVersion(GetDownloadReleases(identifier), version)
+			if err != nil {
+				utils.Logger.Error("No version satisfies the constraint", utils.Logger.Args("recipe", identifier, "constraint", version, "error", err))
+				return nil, err
+			}
+			utils.Logger.Info("Selected version", utils.Logger.Args("recipe", identifier, "constraint", version, "version", r.Version))
+			version = r.Version
+		}
+
 		/* get the summary if it exists from appstream */
-		if as, ok := recipe.MetaData["appstream"]; ok {
+		if answer.Summary != "" {
+			recipe.Summary = answer.Summary
+		} else if as, ok := recipe.MetaData["appstream"]; ok {
 			if summary, ok := as["summary"]; ok {
 				recipe.Summary = summary.(string)
 			}
 		} else {
-			result, _ := pterm.DefaultInteractiveTextInput.WithMultiLine(false).Show("Summary")
-			recipe.Summary = strings.TrimSpace(result)
+			/* fall back to the description of the project metadata */
+			summary, err := answers.Ask(identifier, "Summary", opts.Interactive, func() (string, error) {
+				return strings.TrimSpace(recipe.Description), nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			recipe.Summary = summary
 		}
-		/* get version from Appstream */
-		if as, ok := recipe.MetaData["appstream"]; ok {
-			if version, ok := as["version"]; ok {
-				recipe.Version = version.(string)
+		/* a release set pins every recipe of a group to the same release,
+		 * otherwise get the version from Appstream */
+		if group, release, ok, err := getReleaseSet(recipe.Identifier); err != nil {
+			return nil, err
+		} else if ok {
+			relversion, err := GetReleaseVersion(recipe.Identifier, group, release)
+			if err != nil {
+				utils.Logger.Error("Failed to get release version", utils.Logger.Args("error", err))
+				return nil, err
 			}
+			if version != "" && version != relversion {
+				return nil, fmt.Errorf("version %s is not part of %s %s", version, group, release)
+			}
+			recipe.Version = relversion
+			recipe.ReleaseGroup = group
+			recipe.Release = release
+		} else if version != "" {
+			recipe.Version = version
+		} else if as, ok := recipe.MetaData["appstream"]; ok && as["version"] != nil {
+			recipe.Version = as["version"].(string)
 		} else {
-			result, _ := pterm.DefaultInteractiveTextInput.WithMultiLine(false).Show("Version Number")
-			recipe.Version = strings.TrimSpace(result)
+			/* fall back to the newest tarball on download.kde.org */
+			version, err := answers.Ask(identifier, "Version", opts.Interactive, func() (string, error) {
+				return GetLatestVersion(recipe.Identifier)
+			})
+			if err != nil {
+				return nil, err
+			}
+			recipe.Version = version
 		}
 		if dlpath, err := GetDownloadPath(recipe.Identifier, recipe.Version); err != nil {
 			utils.Logger.Error("Failed to get download path", utils.Logger.Args("error", err))
@@ -359,8 +460,15 @@ func (l *KDEBe) GetRecipe(identifier string) (*source.RecipeSource, error) {
 		} else {
 			recipe.SrcURI = dlpath
 		}
+		/* let devtool and the auto upgrade helper find new releases */
+		if uri, regex, err := GetUpstreamCheck(recipe.Identifier, recipe.Version); err != nil {
+			utils.Logger.Warn("Failed to get upstream check", utils.Logger.Args("error", err))
+		} else {
+			recipe.UpstreamCheckURI = uri
+			recipe.UpstreamCheckRegex = regex
+		}
 		if (len(recipe.SrcURI) > 0) {
-			if sha, err := GetDownloadSHA(recipe.Identifier, recipe.Version); err != nil {
+			if sha, err := GetDownloadSHA(recipe.Identifier, recipe.Version, opts.Quiet); err != nil {
 				utils.Logger.Error("Failed to get download SHA", utils.Logger.Args("error", err))
 			} else {
 				recipe.SrcSHA256 = sha
@@ -386,9 +494,136 @@ func (l *KDEBe) GetRecipe(identifier string) (*source.RecipeSource, error) {
 		} else {
 			recipe.Depends = depends
 		}
+
+		if bs, err := GetBuildSystem(recipe); err != nil {
+			utils.Logger.Error("Failed to detect Build System", utils.Logger.Args("error", err))
+		} else {
+			recipe.BuildSystem = bs
+		}
+
+		/* the dependency data only covers KDE projects, so pick up Qt
+		 * and third party libraries from the CMakeLists.txt */
+		if pkgs, err := GetCMakePackages(recipe); err != nil {
+			utils.Logger.Error("Failed to get CMake Packages", utils.Logger.Args("error", err))
+		} else {
+			if cmakedeps, err := GetCMakeDepends(recipe, pkgs, recipe.Depends); err != nil {
+				utils.Logger.Error("Failed to get CMake Depends", utils.Logger.Args("error", err))
+			} else {
+				recipe.Depends = append(recipe.Depends, cmakedeps...)
+			}
+		}
 		recipe.Section = path.Dir(recipe.Repopath)
 
 		return &recipe.RecipeSource, nil
 	}
 	return nil, errors.New("Recipe Not Found")
 }
+
+/* LatestVersion returns the version GetRecipe would pick, without
+ * prompting: the release set, AppStream, or the newest stable tarball */
+func (l *KDEBe) LatestVersion(identifier string) (string, error) {
+	recipe, ok := l.pr[identifier]
+	if !ok {
+		return "", errors.New("Recipe Not Found")
+	}
+	if group, release, ok, err := getReleaseSet(identifier); err != nil {
+		return "", err
+	} else if ok {
+		return GetReleaseVersion(identifier, group, release)
+	}
+	if as, ok := recipe.MetaData["appstream"]; ok {
+		if version, ok := as["version"]; ok {
+			return version.(string), nil
+		}
+	}
+	return GetLatestVersion(identifier)
+}
+
+/* Releases returns the versions published on download.kde.org, along with
+ * releases only announced in the AppStream data, oldest first */
+func (l *KDEBe) Releases(identifier string) ([]source.Release, error) {
+	recipe, ok := l.pr[identifier]
+	if !ok {
+		return nil, errors.New("Recipe Not Found")
+	}
+	releases := GetDownloadReleases(identifier)
+	if as, ok := recipe.MetaData["appstream"]; ok {
+		if dates, ok := as["releases"].(map[string]interface{}); ok {
+			for version, date := range dates {
+				found := false
+				for i, r := range releases {
+					if r.Version != version {
+						continue
+					}
+					found = true
+					releases[i].Announced = appstreamDate(fmt.Sprint(date))
+					if r.Date.IsZero() {
+						releases[i].Date = releases[i].Announced
+					}
+				}
+				if found {
+					continue
+				}
+				r := source.Release{Version: version, Origin: "appstream"}
+				r.Date = appstreamDate(fmt.Sprint(date))
+				r.Announced = r.Date
+				if v, err := semver.NewVersion(version); err != nil || v.Prerelease() != "" {
+					r.Prerelease = true
+				}
+				releases = append(releases, r)
+			}
+		}
+	}
+	if len(releases) == 0 {
+		return nil, errors.New("No releases found")
+	}
+	sort.SliceStable(releases, func(i, j int) bool {
+		vi, erri := semver.NewVersion(releases[i].Version)
+		vj, errj := semver.NewVersion(releases[j].Version)
+		if erri != nil || errj != nil {
+			return erri != nil && errj == nil
+		}
+		return vi.LessThan(vj)
+	})
+	return releases, nil
+}
+
+/* appstreamDate parses the date of an AppStream release, which may be a
+ * plain date or a full ISO 8601 timestamp */
+func appstreamDate(date string) time.Time {
+	if len(date) > 10 {
+		date = date[:10]
+	}
+	t, _ := time.Parse("2006-01-02", date)
+	return t
+}
+
+/* getReleaseSet returns the release a source is pinned to by the
+ * kdeconfig.releaseset setting. Entries are group=release, or just the
+ * group to pin to its latest stable release */
+func getReleaseSet(identifier string) (group string, release string, ok bool, err error) {
+	group, ingroup := GetReleaseGroup(identifier)
+	if !ingroup {
+		return "", "", false, nil
+	}
+	for _, rs := range viper.GetStringSlice("kdeconfig.releaseset") {
+		name, rel, _ := strings.Cut(rs, "=")
+		g, valid := NormalizeReleaseGroup(name)
+		if !valid {
+			utils.Logger.Error("Unknown release group", utils.Logger.Args("group", name))
+			return "", "", false, errors.New("unknown release group " + name)
+		}
+		if g != group {
+			continue
+		}
+		if rel == "" {
+			releases := GetReleases(group)
+			if len(releases) == 0 {
+				return "", "", false, errors.New("no releases found for " + group)
+			}
+			rel = releases[len(releases)-1]
+		}
+		return group, rel, true, nil
+	}
+	return "", "", false, nil
+}
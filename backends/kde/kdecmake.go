@@ -0,0 +1,98 @@
+package kde
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/parsers"
+	"github.com/Fishwaldo/go-yocto/parsers/cmake"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/xanzy/go-gitlab"
+)
+
+func GetCMakePackages(pr Project) (pkgs []cmake.Package, err error) {
+	utils.Logger.Trace("Getting CMakeLists", utils.Logger.Args("project", pr.Name))
+	gl, err := gitlab.NewClient(utils.Config.KDEConfig.AccessToken, gitlab.WithBaseURL(utils.Config.KDEConfig.KDEGitLabURL+"/api/v4"))
+	if err != nil {
+		utils.Logger.Error("Failed to create GitLab client", utils.Logger.Args("error", err))
+		return nil, err
+	}
+	gf := &gitlab.GetFileOptions{
+		Ref: gitlab.String(pr.MetaData["branch-rules"]["branch"].(string)),
+	}
+	f, res, err := gl.RepositoryFiles.GetFile(pr.Repopath, "CMakeLists.txt", gf)
+	if err != nil {
+		if res != nil && res.StatusCode == 404 {
+			utils.Logger.Trace("No CMakeLists.txt", utils.Logger.Args("project", pr.Name))
+			return nil, nil
+		}
+		utils.Logger.Error("Failed to get CMakeLists.txt", utils.Logger.Args("error", err))
+		return nil, err
+	}
+	content, err := base64.StdEncoding.DecodeString(f.Content)
+	if err != nil {
+		utils.Logger.Error("Failed to decode CMakeLists.txt", utils.Logger.Args("error", err))
+		return nil, err
+	}
+	p, err := parsers.GetParser("cmake")
+	if err != nil {
+		utils.Logger.Error("Failed to get cmake parser", utils.Logger.Args("error", err))
+		return nil, err
+	}
+	md, err := p.Parse(strings.NewReader(string(content)))
+	if err != nil {
+		utils.Logger.Error("Failed to parse CMakeLists.txt", utils.Logger.Args("error", err))
+		return nil, err
+	}
+	pkgs, ok := md["packages"].([]cmake.Package)
+	if !ok {
+		return nil, errors.New("cmake parser returned no packages")
+	}
+	return pkgs, nil
+}
+
+/* build systems, by the file in the top level directory that marks them */
+var buildsystems = []struct {
+	file   string
+	system string
+}{
+	{"CMakeLists.txt", "cmake"},
+	{"meson.build", "meson"},
+	{"pyproject.toml", "python"},
+	{"setup.py", "python"},
+	{"configure.ac", "autotools"},
+	{"Makefile", "make"},
+}
+
+/* GetBuildSystem detects the build system of a project from the files in
+ * its top level directory */
+func GetBuildSystem(pr Project) (string, error) {
+	utils.Logger.Trace("Detecting Build System", utils.Logger.Args("project", pr.Name))
+	gl, err := gitlab.NewClient(utils.Config.KDEConfig.AccessToken, gitlab.WithBaseURL(utils.Config.KDEConfig.KDEGitLabURL+"/api/v4"))
+	if err != nil {
+		utils.Logger.Error("Failed to create GitLab client", utils.Logger.Args("error", err))
+		return "", err
+	}
+	lt := &gitlab.ListTreeOptions{
+		Ref:         gitlab.String(pr.MetaData["branch-rules"]["branch"].(string)),
+		ListOptions: gitlab.ListOptions{PerPage: 100},
+	}
+	nodes, _, err := gl.Repositories.ListTree(pr.Repopath, lt)
+	if err != nil {
+		utils.Logger.Error("Failed to list repository", utils.Logger.Args("error", err))
+		return "", err
+	}
+	files := make(map[string]bool)
+	for _, n := range nodes {
+		if n.Type == "blob" {
+			files[n.Name] = true
+		}
+	}
+	for _, bs := range buildsystems {
+		if files[bs.file] {
+			return bs.system, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,96 @@
+package kde
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Fishwaldo/go-yocto/source"
+	"github.com/Fishwaldo/go-yocto/utils"
+)
+
+/* Details returns what the caches know about a project: its repository,
+ * the branch the branch rules pick, the AppStream data, the tarballs on
+ * download.kde.org and the dependency data in both directions */
+func (l *KDEBe) Details(identifier string) (*source.Details, error) {
+	utils.Logger.Trace("Getting KDE Details", utils.Logger.Args("identifier", identifier))
+	pr, ok := l.pr[identifier]
+	if !ok {
+		return nil, errors.New("Recipe Not Found")
+	}
+	d := &source.Details{
+		Name:        pr.Name,
+		Identifier:  pr.Identifier,
+		Backend:     l.GetName(),
+		Description: pr.Description,
+		URL:         pr.Url,
+		Repopath:    pr.Repopath,
+		Active:      pr.Repoactive,
+		/* empty lists rather than null, for --output json */
+		Topics:         append([]string{}, pr.Topics...),
+		Releases:       []source.Release{},
+		Downloads:      []source.Download{},
+		Depends:        []string{},
+		ReverseDepends: []string{},
+	}
+	if branch, ok := pr.MetaData["branch-rules"]["branch"].(string); ok {
+		d.Branch = branch
+	}
+	if as, ok := pr.MetaData["appstream"]; ok {
+		if summary, ok := as["summary"].(string); ok {
+			d.Summary = summary
+		}
+		if description, ok := as["description"].(string); ok {
+			d.AppStreamDescription = description
+		}
+	}
+	if releases, err := l.Releases(identifier); err == nil {
+		d.Releases = releases
+	}
+	for _, r := range GetDownloadReleases(identifier) {
+		url, err := GetDownloadPath(identifier, r.Version)
+		if err != nil {
+			continue
+		}
+		dl := source.Download{Version: r.Version, URL: url, Prerelease: r.Prerelease}
+		if !r.Date.IsZero() {
+			dl.Date = r.Date.Format("2006-01-02")
+		}
+		d.Downloads = append(d.Downloads, dl)
+	}
+	d.Depends = append(d.Depends, l.dep[pr.ProjectPath]...)
+	for project, deps := range l.dep {
+		for _, dep := range deps {
+			if dep == pr.ProjectPath {
+				d.ReverseDepends = append(d.ReverseDepends, project)
+				break
+			}
+		}
+	}
+	sort.Strings(d.ReverseDepends)
+	if pr.Bugzilla.Product != "" {
+		d.Bugzilla = pr.Bugzilla.Product
+		if pr.Bugzilla.Component != "" {
+			d.Bugzilla += "/" + pr.Bugzilla.Component
+		}
+	}
+	return d, nil
+}
+
+/* FetchDetails fills in the details that need invent.kde.org, the
+ * licenses in the LICENSES directory of the branch */
+func (l *KDEBe) FetchDetails(d *source.Details) error {
+	pr, ok := l.pr[d.Identifier]
+	if !ok {
+		return errors.New("Recipe Not Found")
+	}
+	if _, ok := pr.MetaData["branch-rules"]["branch"].(string); !ok {
+		return fmt.Errorf("no branch for %s", d.Identifier)
+	}
+	licenses, err := GetLicense(pr)
+	if err != nil {
+		return err
+	}
+	d.Licenses = licenses
+	return nil
+}
@@ -11,13 +11,49 @@ import (
 	"crypto/sha256"
 	"io"
 	"fmt"
+	"path"
+	"sort"
+	"time"
 
+	"github.com/Fishwaldo/go-yocto/source"
 	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/Masterminds/semver/v3"
 	"github.com/pterm/pterm"
 )
 
 type dirListing struct {
 	Directory string
+	Date string `json:",omitempty"`
+}
+
+var lsdate = regexp.MustCompile(`\s([A-Z][a-z]{2})\s+(\d{1,2})\s+(\d{4}|\d{1,2}:\d{2})\s`)
+var lsisodate = regexp.MustCompile(`\s(\d{4}-\d{2}-\d{2})[\sT]`)
+
+/* listingDate returns the modification date of a ls -l line as
+ * 2006-01-02. Recent files only carry the time, so their year is the
+ * current one, or the last if that would be in the future */
+func listingDate(line string, now time.Time) string {
+	if m := lsisodate.FindStringSubmatch(line); m != nil {
+		return m[1]
+	}
+	m := lsdate.FindStringSubmatch(line)
+	if m == nil {
+		return ""
+	}
+	if !strings.Contains(m[3], ":") {
+		if t, err := time.Parse("Jan 2 2006", m[1]+" "+m[2]+" "+m[3]); err == nil {
+			return t.Format("2006-01-02")
+		}
+		return ""
+	}
+	t, err := time.Parse("Jan 2 2006", fmt.Sprintf("%s %s %d", m[1], m[2], now.Year()))
+	if err != nil {
+		return ""
+	}
+	if t.After(now) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t.Format("2006-01-02")
 }
 
 var files map[string]map[string]dirListing = make(map[string]map[string]dirListing)
@@ -48,6 +84,7 @@ func RefreshDownloadLocations() (error) {
 	var directory = regexp.MustCompile(`^(\./)?(.+):$`)
 	var fn = regexp.MustCompile(`^[^dl].* ((.*)-(.*)\.tar\.(bz2|xz))$`)
 	var curdir string
+	now := time.Now()
 	for scanner.Scan() {
 		if directory.MatchString(scanner.Text()) {
 			curdir = strings.TrimPrefix( directory.FindStringSubmatch(scanner.Text())[2], "/srv/archives/ftp/")
@@ -58,7 +95,7 @@ func RefreshDownloadLocations() (error) {
 			if _, ok := files[f[2]]; !ok {
 				files[f[2]] = make(map[string]dirListing)
 			}
-			files[f[2]][f[3]] = dirListing{Directory: curdir + "/" + f[1]}
+			files[f[2]][f[3]] = dirListing{Directory: curdir + "/" + f[1], Date: listingDate(scanner.Text(), now)}
 		}
 	}
 	cache, err := json.Marshal(files)
@@ -84,7 +121,9 @@ func GetDownloadPath(source string, version string) (string, error) {
 	return "https://download.kde.org/" + files[source][version].Directory, nil
 }
 
-func GetDownloadSHA(source string, version string) (string, error) {
+/* GetDownloadSHA downloads a tarball to compute its sha256sum. Quiet turns
+ * off the spinner, which garbles the terminal when several run at once */
+func GetDownloadSHA(source string, version string, quiet bool) (string, error) {
 	if _, ok := files[source]; !ok {
 		return "", errors.New("Source not found")
 	}
@@ -96,22 +135,216 @@ func GetDownloadSHA(source string, version string) (string, error) {
 		return "", err
 	}
 	utils.Logger.Trace("Getting SHA", utils.Logger.Args("path", path))
-	spinnerInfo, _ := pterm.DefaultSpinner.Start("Downloading Source for SHA Calculation")
+	var spinnerInfo *pterm.SpinnerPrinter
+	if !quiet {
+		spinnerInfo, _ = pterm.DefaultSpinner.Start("Downloading Source for SHA Calculation")
+	}
 
 	file, err := http.Get(path)
 	if err != nil {
 		utils.Logger.Warn("Failed to get SHA", utils.Logger.Args("path", path, "error", err))
-		spinnerInfo.Fail("Failed to Download Source for SHA Calculation")
+		if spinnerInfo != nil {
+			spinnerInfo.Fail("Failed to Download Source for SHA Calculation")
+		}
 		return "", err
 	}
 	defer file.Body.Close()
 	hash := sha256.New()
 	if _, err := io.Copy(hash, file.Body); err != nil {
 		utils.Logger.Warn("Failed to calculate SHA", utils.Logger.Args("path", path, "error", err))
-		spinnerInfo.Fail("Failed to Download Source for SHA Calculation")
+		if spinnerInfo != nil {
+			spinnerInfo.Fail("Failed to Download Source for SHA Calculation")
+		}
 		return "", err
 	}
-	spinnerInfo.Success("Downloaded Source for SHA Calculation")
+	if spinnerInfo != nil {
+		spinnerInfo.Success("Downloaded Source for SHA Calculation")
+	}
 	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 
-}
\ No newline at end of file
+}
+
+var versiondir = regexp.MustCompile(`^\d+(\.\d+)+$`)
+
+/* GetUpstreamCheck returns the UPSTREAM_CHECK_URI and UPSTREAM_CHECK_REGEX
+ * that find newer releases of source. When the tarballs live in a
+ * directory per version the directory listing above them is checked,
+ * otherwise the tarballs next to this one */
+func GetUpstreamCheck(source string, version string) (uri string, regex string, err error) {
+	if _, ok := files[source]; !ok {
+		return "", "", errors.New("Source not found")
+	}
+	dl, ok := files[source][version]
+	if !ok {
+		return "", "", errors.New("Version not found")
+	}
+	dirs := strings.Split(path.Dir(dl.Directory), "/")
+	for i := len(dirs) - 1; i > 0; i-- {
+		if versiondir.MatchString(dirs[i]) {
+			return "https://download.kde.org/" + strings.Join(dirs[:i], "/") + "/", `(?P<pver>\d+(\.\d+)+)/`, nil
+		}
+	}
+	return "https://download.kde.org/" + path.Dir(dl.Directory) + "/", regexp.QuoteMeta(source) + `-(?P<pver>\d+(\.\d+)+)\.tar`, nil
+}
+
+var releasedir = regexp.MustCompile(`^(stable|unstable)/(frameworks|plasma|release-service)/([^/]+)/`)
+
+/* release groups as found in the download directory layout, and the name
+ * we use for them in recipes */
+var releasegroups = map[string]string{
+	"frameworks":      "kde-frameworks",
+	"plasma":          "kde-plasma",
+	"release-service": "kde-gear",
+}
+
+/* releaseGroup returns the coordinated release a tarball was published
+ * in, eg stable/frameworks/5.106/kio-5.106.0.tar.xz is kde-frameworks 5.106 */
+func (d dirListing) releaseGroup() (group string, release string, stable bool, ok bool) {
+	m := releasedir.FindStringSubmatch(d.Directory)
+	if m == nil {
+		return "", "", false, false
+	}
+	return releasegroups[m[2]], m[3], m[1] == "stable", true
+}
+
+/* NormalizeReleaseGroup accepts the directory name (frameworks,
+ * release-service), the recipe name (kde-frameworks) or gear */
+func NormalizeReleaseGroup(name string) (string, bool) {
+	name = strings.ToLower(name)
+	if g, ok := releasegroups[name]; ok {
+		return g, true
+	}
+	if name == "gear" {
+		return "kde-gear", true
+	}
+	for _, g := range releasegroups {
+		if g == name {
+			return g, true
+		}
+	}
+	return "", false
+}
+
+/* GetReleaseGroup returns the release group a source is published in.
+ * Sources that moved between groups, eg kwayland from plasma to
+ * frameworks, belong to the group of their newest stable version, with
+ * unstable versions only counting when there is no stable one */
+func GetReleaseGroup(source string) (string, bool) {
+	group := ""
+	var newest *semver.Version
+	newestStable := false
+	for version, dl := range files[source] {
+		g, _, stable, ok := dl.releaseGroup()
+		if !ok {
+			continue
+		}
+		v, err := semver.NewVersion(version)
+		if err != nil {
+			continue
+		}
+		switch {
+		case newest == nil, stable && !newestStable:
+		case stable != newestStable, v.LessThan(newest):
+			continue
+		/* the same version in two groups, pick one the same way each run */
+		case v.Equal(newest) && g >= group:
+			continue
+		}
+		group, newest, newestStable = g, v, stable
+	}
+	return group, newest != nil
+}
+
+/* GetReleases returns the stable releases of a group, oldest first */
+func GetReleases(group string) (releases []string) {
+	seen := make(map[string]bool)
+	var versions []*semver.Version
+	for _, versionlist := range files {
+		for _, dl := range versionlist {
+			g, release, stable, ok := dl.releaseGroup()
+			if !ok || !stable || g != group || seen[release] {
+				continue
+			}
+			seen[release] = true
+			if v, err := semver.NewVersion(release); err == nil {
+				versions = append(versions, v)
+			}
+		}
+	}
+	sort.Sort(semver.Collection(versions))
+	for _, v := range versions {
+		releases = append(releases, v.Original())
+	}
+	return releases
+}
+
+/* GetReleaseVersion returns the version of source shipped in a release */
+func GetReleaseVersion(source string, group string, release string) (string, error) {
+	if _, ok := files[source]; !ok {
+		return "", errors.New("Source not found")
+	}
+	for version, dl := range files[source] {
+		if g, r, stable, ok := dl.releaseGroup(); ok && stable && g == group && r == release {
+			return version, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not part of %s %s", source, group, release)
+}
+
+
+/* GetVersions returns the published versions of source, oldest first.
+ * Versions that only appear in unstable directories are skipped unless
+ * unstable is set */
+func GetVersions(source string, unstable bool) (versions []string) {
+	var vs []*semver.Version
+	var other []string
+	for version, dl := range files[source] {
+		if !unstable && !strings.HasPrefix(dl.Directory, "stable/") {
+			continue
+		}
+		if v, err := semver.NewVersion(version); err == nil {
+			vs = append(vs, v)
+		} else {
+			other = append(other, version)
+		}
+	}
+	sort.Sort(semver.Collection(vs))
+	sort.Strings(other)
+	versions = append(versions, other...)
+	for _, v := range vs {
+		versions = append(versions, v.Original())
+	}
+	return versions
+}
+
+/* GetLatestVersion returns the newest stable version of source */
+func GetLatestVersion(source string) (string, error) {
+	if _, ok := files[source]; !ok {
+		return "", errors.New("Source not found")
+	}
+	versions := GetVersions(source, false)
+	if len(versions) == 0 {
+		return "", errors.New("No stable version found")
+	}
+	return versions[len(versions)-1], nil
+}
+
+/* GetDownloadReleases returns every published version of a source with
+ * the date it was uploaded, oldest first. Versions only in unstable
+ * directories, or with a semver prerelease, are prereleases */
+func GetDownloadReleases(identifier string) (releases []source.Release) {
+	for _, version := range GetVersions(identifier, true) {
+		dl := files[identifier][version]
+		r := source.Release{Version: version, Origin: "download.kde.org"}
+		if !strings.HasPrefix(dl.Directory, "stable/") {
+			r.Prerelease = true
+		} else if v, err := semver.NewVersion(version); err == nil && v.Prerelease() != "" {
+			r.Prerelease = true
+		}
+		if dl.Date != "" {
+			r.Date, _ = time.Parse("2006-01-02", dl.Date)
+		}
+		releases = append(releases, r)
+	}
+	return releases
+}
@@ -3,35 +3,17 @@ package kde
 import (
 	"path"
 
+	"github.com/Fishwaldo/go-yocto/mapping"
+	"github.com/Fishwaldo/go-yocto/parsers/cmake"
 	"github.com/Fishwaldo/go-yocto/utils"
 )
 
-var inheritmap map[string]string = make(map[string]string)
-var dependmap map[string]string = make(map[string]string)
-
-func init() {
-	inheritmap = map[string]string {
-		"frameworks/extra-cmake-modules": "cmake_plasma",
-		"frameworks/kauth": "kauth",
-		"frameworks/kcmutils": "kcmutils",
-		"frameworks/kconfig": "kconfig",
-		"frameworks/kcoreaddons": "kcoreaddons",
-		"frameworks/kdoctools": "kdoctools",
-		"frameworks/ki18n" : "ki18n",
-	}
-	dependmap = map[string]string {
-	}
-
-}
-
-
-
 func GetInherits(pr Project, depmap map[string][]string) (inherits []string, err error) {
 	utils.Logger.Trace("Getting Inherits", utils.Logger.Args("project", pr.Name))
 	if _, ok := depmap[pr.ProjectPath]; ok {
 		for _, v := range depmap[pr.ProjectPath] {
-			if i, ok := inheritmap[v]; ok {
-				inherits = append(inherits, i)
+			if m, ok := mapping.Lookup(v); ok && m.Inherit != "" {
+				inherits = append(inherits, m.Inherit)
 			}
 		}
 	}
@@ -45,10 +27,52 @@ func GetDepends(pr Project, depmap map[string][]string) (depends []string, err e
 	utils.Logger.Trace("Getting Depends", utils.Logger.Args("project", pr.Name))
 	if _, ok := depmap[pr.ProjectPath]; ok {
 		for _, v := range depmap[pr.ProjectPath] {
-			if _, ok := inheritmap[v]; !ok {
-				depends = append(depends, path.Base(v))
+			if m, ok := mapping.Lookup(v); ok {
+				if d := m.Depend(); d != "" {
+					depends = append(depends, d)
+				}
+				continue
 			}
+			depends = append(depends, path.Base(v))
 		}
 	}
 	return depends, nil
-}
\ No newline at end of file
+}
+
+/* GetCMakeDepends maps the required packages found in the projects
+ * CMakeLists.txt to recipe names. Packages that resolve to a recipe we
+ * already depend on, or to nothing at all, are skipped. Unmapped packages
+ * are kept by their upstream name, for the recipe to resolve them through
+ * the provides index or report them as unresolved */
+func GetCMakeDepends(pr Project, pkgs []cmake.Package, existing []string) (depends []string, err error) {
+	utils.Logger.Trace("Getting CMake Depends", utils.Logger.Args("project", pr.Name))
+	seen := make(map[string]bool)
+	for _, d := range existing {
+		seen[d] = true
+	}
+	for _, pkg := range pkgs {
+		if !pkg.Required() {
+			utils.Logger.Trace("Skipping non-required CMake package", utils.Logger.Args("project", pr.Name, "package", pkg.Name, "type", pkg.Type))
+			continue
+		}
+		for _, name := range pkg.Names() {
+			var recipe string
+			m, ok := mapping.Lookup(name)
+			if !ok {
+				m, ok = mapping.Lookup(pkg.Name)
+			}
+			if ok {
+				recipe = m.Depend()
+			} else {
+				utils.Logger.Warn("Unmapped CMake package", utils.Logger.Args("project", pr.Name, "package", name, "command", pkg.Command))
+				recipe = name
+			}
+			if recipe == "" || seen[recipe] {
+				continue
+			}
+			seen[recipe] = true
+			depends = append(depends, recipe)
+		}
+	}
+	return depends, nil
+}
@@ -0,0 +1,26 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/Fishwaldo/go-yocto/cmd/mapping"
+	"github.com/spf13/cobra"
+)
+
+// mappingCmd represents the mapping command
+var mappingCmd = &cobra.Command{
+	Use:   "mapping",
+	Short: "Inspect the dependency to recipe mappings",
+	Long: `Inspect the mappings used to turn upstream dependencies into
+recipe names, inherited classes or native tools.
+
+Mappings are loaded from the builtin defaults, the user mapping file
+and the mapping file of each layer, with later files taking precedence.`,
+}
+
+func init() {
+	rootCmd.AddCommand(mappingCmd)
+	mappingCmd.AddCommand(cmdMapping.ListCmd)
+	mappingCmd.AddCommand(cmdMapping.LookupCmd)
+}
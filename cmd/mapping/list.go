@@ -0,0 +1,28 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmdMapping
+
+import (
+	"strconv"
+
+	"github.com/Fishwaldo/go-yocto/mapping"
+	"github.com/Fishwaldo/go-yocto/output"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// ListCmd represents the mapping list command
+var ListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the effective dependency mappings",
+	Long:  `List the effective dependency mappings and the file they came from`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		td := pterm.TableData{{"Key", "Recipe", "Inherit", "Native", "Ignore", "Source"}}
+		for _, m := range mapping.List() {
+			td = append(td, []string{m.Key, m.Recipe, m.Inherit, strconv.FormatBool(m.Native), strconv.FormatBool(m.Ignore), m.Source})
+		}
+		output.Render(td)
+	},
+}
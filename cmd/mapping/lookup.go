@@ -0,0 +1,36 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmdMapping
+
+import (
+	"github.com/Fishwaldo/go-yocto/mapping"
+	"github.com/Fishwaldo/go-yocto/output"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// LookupCmd represents the mapping lookup command
+var LookupCmd = &cobra.Command{
+	Use:   "lookup <dependency>...",
+	Short: "Test how dependencies are mapped",
+	Long: `Show how each upstream dependency (a KDE repository path, CMake
+package or pkg-config module) resolves to a recipe, inherit or native tool`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		td := pterm.TableData{{"Dependency", "Matched", "Depends", "Inherit", "Source"}}
+		for _, dep := range args {
+			m, ok := mapping.Lookup(dep)
+			if !ok {
+				td = append(td, []string{dep, "", "", "", "unmapped"})
+				continue
+			}
+			depends := m.Depend()
+			if m.Ignore {
+				depends = "(ignored)"
+			}
+			td = append(td, []string{dep, m.Key, depends, m.Inherit, m.Source})
+		}
+		output.Render(td)
+	},
+}
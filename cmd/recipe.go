@@ -31,9 +31,42 @@ to quickly create a Cobra application.`,
 func init() {
 	rootCmd.AddCommand(recipeCmd)
 	recipeCmd.AddCommand(cmdRecipe.CreateCmd)
+	recipeCmd.AddCommand(cmdRecipe.ProvidesCmd)
+	recipeCmd.AddCommand(cmdRecipe.LayersCmd)
+	recipeCmd.AddCommand(cmdRecipe.UpgradeCmd)
+	recipeCmd.AddCommand(cmdRecipe.OutdatedCmd)
+	recipeCmd.AddCommand(cmdRecipe.RefreshCmd)
 
-	cmdRecipe.CreateCmd.Flags().StringP("layer", "l", ".", "Layer Directory to create recipe in")
-	if err := viper.BindPFlag("yocto.layerdirectory", cmdRecipe.CreateCmd.Flags().Lookup("layer")); err != nil {
-		utils.Logger.Error("Failed to Bind Flag", utils.Logger.Args("flag", "layer", "error", err))
+	cmdRecipe.CreateCmd.Flags().IntP("jobs", "j", 4, "Number of recipes to resolve concurrently when creating many recipes")
+	if err := viper.BindPFlag("recipe.jobs", cmdRecipe.CreateCmd.Flags().Lookup("jobs")); err != nil {
+		utils.Logger.Error("Failed to Bind Flag", utils.Logger.Args("flag", "jobs", "error", err))
+	}
+	recipeCmd.PersistentFlags().StringSlice("release-set", nil, "Pin recipes of a release group to one release, eg frameworks=5.106 or plasma for the latest")
+	if err := viper.BindPFlag("kdeconfig.releaseset", recipeCmd.PersistentFlags().Lookup("release-set")); err != nil {
+		utils.Logger.Error("Failed to Bind Flag", utils.Logger.Args("flag", "release-set", "error", err))
+	}
+	cmdRecipe.CreateCmd.Flags().Bool("with-deps", false, "Also create missing dependancy recipes, bottom-up")
+	if err := viper.BindPFlag("recipe.withdeps", cmdRecipe.CreateCmd.Flags().Lookup("with-deps")); err != nil {
+		utils.Logger.Error("Failed to Bind Flag", utils.Logger.Args("flag", "with-deps", "error", err))
+	}
+	recipeCmd.PersistentFlags().Bool("dry-run", false, "Print the recipe files instead of writing them")
+	if err := viper.BindPFlag("recipe.dryrun", recipeCmd.PersistentFlags().Lookup("dry-run")); err != nil {
+		utils.Logger.Error("Failed to Bind Flag", utils.Logger.Args("flag", "dry-run", "error", err))
+	}
+	recipeCmd.PersistentFlags().Bool("diff", false, "Show a diff against the recipe files in the layer instead of writing them")
+	if err := viper.BindPFlag("recipe.diff", recipeCmd.PersistentFlags().Lookup("diff")); err != nil {
+		utils.Logger.Error("Failed to Bind Flag", utils.Logger.Args("flag", "diff", "error", err))
+	}
+	cmdRecipe.CreateCmd.Flags().BoolP("wizard", "w", false, "Step through the detected metadata, version and dependancies, and save the answers to the layer")
+	if err := viper.BindPFlag("recipe.wizard", cmdRecipe.CreateCmd.Flags().Lookup("wizard")); err != nil {
+		utils.Logger.Error("Failed to Bind Flag", utils.Logger.Args("flag", "wizard", "error", err))
+	}
+	recipeCmd.PersistentFlags().String("answers", "", "YAML file with the version and summary of recipes, keyed by identifier")
+	if err := viper.BindPFlag("answers.file", recipeCmd.PersistentFlags().Lookup("answers")); err != nil {
+		utils.Logger.Error("Failed to Bind Flag", utils.Logger.Args("flag", "answers", "error", err))
+	}
+	recipeCmd.PersistentFlags().Bool("non-interactive", false, "Never prompt, fail if a value cannot be found")
+	if err := viper.BindPFlag("answers.noninteractive", recipeCmd.PersistentFlags().Lookup("non-interactive")); err != nil {
+		utils.Logger.Error("Failed to Bind Flag", utils.Logger.Args("flag", "non-interactive", "error", err))
 	}
 }
@@ -4,22 +4,164 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmdRecipe
 
 import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/answers"
+	"github.com/Fishwaldo/go-yocto/output"
 	"github.com/Fishwaldo/go-yocto/recipe"
 	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	manifest string
+	version  string
+	summary  string
 )
 
 // createCmd represents the update command
 var CreateCmd = &cobra.Command{
-	Use:   "create",
+	Use:   "create <backend> [identifier|glob]",
 	Short: "Create a new recipe",
-	Long: `Create a new recipe`,
-	Args: cobra.ExactArgs(2),
+	Long: `Create a new recipe.
+
+The identifier may also be a repopath glob such as frameworks/*, or a
+manifest file listing identifiers can be given with --manifest, to create
+many recipes at once.
+
+With --dry-run the files are printed, and with --diff a diff against the
+layer is shown, instead of writing them. Both exit with status 1 if the
+layer would change. A recipe that fails to be created exits with status 1
+too.
+
+Values that are missing upstream are prompted for. With --non-interactive,
+or when the CI environment variable is set, they come from --version,
+--summary or the --answers file instead, falling back to the newest
+tarball and the project description, and are an error if still missing.
+The version may be a constraint, eg ~5.104, for the newest tarball that
+satisfies it. source versions lists the versions a constraint picks from.
+
+With --wizard the detected metadata is shown, and the version and the
+DEPENDS are chosen interactively, mapping dependancies that could not be
+resolved to recipes. The answers can be saved to the overrides and
+mapping files of the layer, so the next run needs no input.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if manifest != "" {
+			return cobra.RangeArgs(1, 2)(cmd, args)
+		}
+		if len(args) != 2 {
+			return errors.New("requires a backend and an identifier")
+		}
+		return nil
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		utils.Logger.Info("Creating Recipe", utils.Logger.Args("backend", args[0], "name", args[1]))
-		recipe.CreateRecipe(args[0], args[1])
+		var patterns []string
+		if manifest != "" {
+			entries, err := recipe.ReadManifest(manifest)
+			if err != nil {
+				utils.Logger.Error("Failed to read manifest", utils.Logger.Args("manifest", manifest, "error", err))
+				os.Exit(1)
+			}
+			patterns = append(patterns, entries...)
+		}
+		if len(args) > 1 {
+			patterns = append(patterns, args[1])
+		}
+		if len(patterns) == 1 && !recipe.IsPattern(patterns[0]) {
+			answers.Provide(patterns[0], answers.Answer{Version: version, Summary: summary})
+			utils.Logger.Info("Creating Recipe", utils.Logger.Args("backend", args[0], "name", patterns[0]))
+			created, err := recipe.CreateRecipe(args[0], patterns[0])
+			if output.Machine() {
+				results := []*recipe.BulkResult{}
+				for _, s := range created {
+					r := s.Record()
+					results = append(results, &recipe.BulkResult{Identifier: s.Identifier, Version: s.Version, Status: recipe.BulkCreated, Overrides: s.Overrides, Recipe: &r})
+				}
+				if err != nil {
+					results = append(results, &recipe.BulkResult{Identifier: patterns[0], Status: recipe.BulkFailed, Reason: err.Error()})
+				}
+				writeResults(results)
+			} else {
+				for _, s := range created {
+					if len(s.Overrides) > 0 {
+						pterm.Info.Println("Overrides applied to " + s.Identifier + ": " + strings.Join(s.Overrides, " "))
+					}
+				}
+			}
+			if err != nil {
+				os.Exit(1)
+			}
+			exitOnPreviewChange()
+			return
+		}
+		if viper.GetBool("recipe.wizard") {
+			utils.Logger.Error("--wizard only applies to a single recipe")
+			os.Exit(1)
+		}
+		if version != "" || summary != "" {
+			utils.Logger.Error("--version and --summary only apply to a single recipe, use an answers file")
+			os.Exit(1)
+		}
+		utils.Logger.Info("Creating Recipes", utils.Logger.Args("backend", args[0], "count", len(patterns)))
+		results, err := recipe.CreateRecipes(args[0], patterns)
+		if err != nil {
+			utils.Logger.Error("Failed to create recipes", utils.Logger.Args("error", err))
+			if results == nil {
+				os.Exit(1)
+			}
+		}
+		failed := err != nil
+		for _, r := range results {
+			failed = failed || r.Status == recipe.BulkFailed
+		}
+		if output.Machine() {
+			writeResults(results)
+			exitOnFailure(failed)
+			return
+		}
+		counts := make(map[string]int)
+		td := pterm.TableData{{"Recipe", "Version", "Status", "Reason", "Overrides"}}
+		for _, r := range results {
+			counts[r.Status]++
+			td = append(td, []string{r.Identifier, r.Version, r.Status, r.Reason, strings.Join(r.Overrides, " ")})
+		}
+		pterm.DefaultTable.WithHasHeader().WithData(td).Render()
+		pterm.Info.Printfln("%d created, %d skipped because they exist, %d failed", counts[recipe.BulkCreated], counts[recipe.BulkExisting], counts[recipe.BulkFailed])
+		exitOnFailure(failed)
 	},
 }
 
+/* writeResults writes the results of a command for --output json or yaml */
+func writeResults(v interface{}) {
+	if err := output.Write(v); err != nil {
+		utils.Logger.Error("Failed to write results", utils.Logger.Args("error", err))
+	}
+}
+
+/* exitOnFailure exits with status 1 if anything failed, so the command
+ * can gate a CI job. Otherwise a preview that would change the layer fails
+ * it as well */
+func exitOnFailure(failed bool) {
+	if failed {
+		os.Exit(1)
+	}
+	exitOnPreviewChange()
+}
+
+/* exitOnPreviewChange fails a --dry-run or --diff that would change the
+ * layer, so it can gate a CI job */
+func exitOnPreviewChange() {
+	if recipe.PreviewChanged() {
+		os.Exit(1)
+	}
+}
+
 func init() {
+	CreateCmd.Flags().StringVarP(&manifest, "manifest", "m", "", "File listing identifiers or repopath globs to create")
+	CreateCmd.Flags().StringVar(&version, "version", "", "Version of the recipe, or a constraint such as ~5.104, instead of the AppStream version")
+	CreateCmd.Flags().StringVar(&summary, "summary", "", "Summary of the recipe, instead of the AppStream summary")
 }
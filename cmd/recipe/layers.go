@@ -0,0 +1,38 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmdRecipe
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/layer"
+	"github.com/Fishwaldo/go-yocto/output"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// LayersCmd represents the recipe layers command
+var LayersCmd = &cobra.Command{
+	Use:   "layers",
+	Short: "Show the layers that are scanned for existing recipes",
+	Long: `Show the layers that are scanned for existing recipes, either from
+conf/bblayers.conf in the build directory or the yocto.layers setting,
+along with the BBFILES, priority and series compatibility from each
+layer's conf/layer.conf`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		layers, err := layer.Discover()
+		if err != nil {
+			utils.Logger.Error("Failed to discover layers", utils.Logger.Args("error", err))
+			return
+		}
+		td := pterm.TableData{{"Layer", "Collection", "Priority", "Compat", "BBFiles"}}
+		for _, l := range layers {
+			td = append(td, []string{l.Path, l.Collection, strconv.Itoa(l.Priority), strings.Join(l.SeriesCompat, " "), strings.Join(l.BBFiles, "\n")})
+		}
+		output.Render(td)
+	},
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmdRecipe
+
+import (
+	"os"
+
+	"github.com/Fishwaldo/go-yocto/output"
+	"github.com/Fishwaldo/go-yocto/recipe"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	outdatedMarkdown bool
+	outdatedAll      bool
+)
+
+// OutdatedCmd represents the outdated command
+var OutdatedCmd = &cobra.Command{
+	Use:   "outdated [backend]",
+	Short: "List recipes with a newer upstream release",
+	Long: `List recipes in the layer that have a newer upstream release.
+
+The current version of each recipe is compared with the releases the
+backend knows about. A newer prerelease is only reported when there is no
+newer stable release. Use --output json or yaml, or --markdown, for CI.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		be := ""
+		if len(args) > 0 {
+			be = args[0]
+		}
+		report, err := recipe.OutdatedRecipes(be)
+		if err != nil {
+			utils.Logger.Error("Failed to check recipes", utils.Logger.Args("error", err))
+			os.Exit(1)
+		}
+		if !outdatedAll {
+			var outdated []*recipe.OutdatedRecipe
+			for _, o := range report {
+				if o.Outdated {
+					outdated = append(outdated, o)
+				}
+			}
+			report = outdated
+		}
+		if output.Machine() {
+			if report == nil {
+				report = []*recipe.OutdatedRecipe{}
+			}
+			writeResults(report)
+			return
+		}
+		if err := recipe.WriteOutdated(os.Stdout, report, outdatedMarkdown); err != nil {
+			utils.Logger.Error("Failed to write report", utils.Logger.Args("error", err))
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	OutdatedCmd.Flags().BoolVar(&outdatedMarkdown, "markdown", false, "Write the report as a markdown table")
+	OutdatedCmd.Flags().BoolVarP(&outdatedAll, "all", "a", false, "Also list recipes that are up to date")
+}
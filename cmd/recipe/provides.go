@@ -0,0 +1,33 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmdRecipe
+
+import (
+	"github.com/Fishwaldo/go-yocto/output"
+	"github.com/Fishwaldo/go-yocto/recipe"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// ProvidesCmd represents the recipe provides command
+var ProvidesCmd = &cobra.Command{
+	Use:   "provides <name>",
+	Short: "Find the recipes providing a dependency",
+	Long: `Search the provides index built from the configured layers for
+recipes providing a name. The name may be a recipe, a PROVIDES entry, a
+pkg-config module or a CMake config package`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := recipe.ScanLayers(); err != nil {
+			utils.Logger.Error("Failed to scan layers", utils.Logger.Args("error", err))
+			return
+		}
+		td := pterm.TableData{{"Name", "Recipe", "Kind", "Source"}}
+		for _, p := range recipe.SearchProvides(args[0]) {
+			td = append(td, []string{p.Name, p.Recipe, p.Kind, p.Source})
+		}
+		output.Render(td)
+	},
+}
@@ -0,0 +1,78 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmdRecipe
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/output"
+	"github.com/Fishwaldo/go-yocto/recipe"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var refreshAll bool
+
+// RefreshCmd represents the refresh command
+var RefreshCmd = &cobra.Command{
+	Use:   "refresh <backend> [identifier...]",
+	Short: "Regenerate the managed parts of existing recipes",
+	Long: `Regenerate the managed parts of existing recipes.
+
+Only the content between the "# BEGIN go-yocto managed" and
+"# END go-yocto managed" markers of the .inc file is rewritten, so
+local additions outside them are kept. A managed variable that is also
+assigned outside the markers is reported as a conflict.
+
+With --all every recipe in the layer is refreshed.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("requires a backend")
+		}
+		if refreshAll && len(args) > 1 {
+			return errors.New("--all does not take identifiers")
+		}
+		if !refreshAll && len(args) < 2 {
+			return errors.New("requires an identifier, or --all")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.Logger.Info("Refreshing Recipes", utils.Logger.Args("backend", args[0], "recipes", args[1:]))
+		results, err := recipe.RefreshRecipes(args[0], args[1:])
+		if err != nil {
+			utils.Logger.Error("Failed to refresh recipes", utils.Logger.Args("error", err))
+			os.Exit(1)
+		}
+		failed := false
+		for _, r := range results {
+			failed = failed || r.Status == recipe.RefreshFailed
+		}
+		if output.Machine() {
+			writeResults(results)
+			exitOnFailure(failed)
+			return
+		}
+		counts := make(map[string]int)
+		td := pterm.TableData{{"Recipe", "Version", "Status", "Conflicts", "Overrides"}}
+		for _, r := range results {
+			counts[r.Status]++
+			status := r.Status
+			if r.Reason != "" {
+				status += ": " + r.Reason
+			}
+			td = append(td, []string{r.Identifier, r.Version, status, strings.Join(r.Conflicts, " "), strings.Join(r.Overrides, " ")})
+		}
+		pterm.DefaultTable.WithHasHeader().WithData(td).Render()
+		pterm.Info.Printfln("%d refreshed, %d unchanged, %d failed", counts[recipe.RefreshRefreshed], counts[recipe.RefreshUnchanged], counts[recipe.RefreshFailed])
+		exitOnFailure(failed)
+	},
+}
+
+func init() {
+	RefreshCmd.Flags().BoolVarP(&refreshAll, "all", "a", false, "Refresh every recipe in the layer")
+}
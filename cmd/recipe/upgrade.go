@@ -0,0 +1,98 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmdRecipe
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/output"
+	"github.com/Fishwaldo/go-yocto/recipe"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var upgradeAll bool
+
+// UpgradeCmd represents the upgrade command
+var UpgradeCmd = &cobra.Command{
+	Use:   "upgrade <backend> [identifier...]",
+	Short: "Upgrade existing recipes to the latest upstream version",
+	Long: `Upgrade existing recipes to the latest upstream version.
+
+The versioned .bb file is renamed, and its SRC_URI and checksum replaced
+with the ones of the new tarball. The .inc file is left alone, so local
+edits are kept. License and dependancy changes in the new version are
+listed so they can be reviewed. The recipes and release includes are
+written all at once, a failure leaves the layer as it was.
+
+With --all every recipe in the layer is upgraded. With --dry-run the
+upgraded files are printed, and with --diff a diff against the layer is
+shown, instead of writing them.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("requires a backend")
+		}
+		if upgradeAll && len(args) > 1 {
+			return errors.New("--all does not take identifiers")
+		}
+		if !upgradeAll && len(args) < 2 {
+			return errors.New("requires an identifier, or --all")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.Logger.Info("Upgrading Recipes", utils.Logger.Args("backend", args[0], "recipes", args[1:]))
+		results, err := recipe.UpgradeRecipes(args[0], args[1:])
+		if err != nil {
+			utils.Logger.Error("Failed to upgrade recipes", utils.Logger.Args("error", err))
+			if results == nil {
+				os.Exit(1)
+			}
+		}
+		failed := err != nil
+		for _, r := range results {
+			failed = failed || r.Status == recipe.UpgradeFailed
+		}
+		if output.Machine() {
+			writeResults(results)
+			exitOnFailure(failed)
+			return
+		}
+		counts := make(map[string]int)
+		td := pterm.TableData{{"Recipe", "Version", "Status", "License", "Depends", "Overrides"}}
+		for _, r := range results {
+			counts[r.Status]++
+			version := r.OldVersion
+			if r.NewVersion != "" && r.NewVersion != r.OldVersion {
+				version += " -> " + r.NewVersion
+			}
+			status := r.Status
+			if r.Reason != "" {
+				status += ": " + r.Reason
+			}
+			td = append(td, []string{r.Identifier, version, status, changes(r.LicenseAdded, r.LicenseRemoved), changes(r.DependsAdded, r.DependsRemoved), strings.Join(r.Overrides, " ")})
+		}
+		pterm.DefaultTable.WithHasHeader().WithData(td).Render()
+		pterm.Info.Printfln("%d upgraded, %d up to date, %d failed", counts[recipe.UpgradeUpgraded], counts[recipe.UpgradeCurrent], counts[recipe.UpgradeFailed])
+		exitOnFailure(failed)
+	},
+}
+
+func changes(added []string, removed []string) string {
+	var c []string
+	for _, a := range added {
+		c = append(c, "+"+a)
+	}
+	for _, r := range removed {
+		c = append(c, "-"+r)
+	}
+	return strings.Join(c, " ")
+}
+
+func init() {
+	UpgradeCmd.Flags().BoolVarP(&upgradeAll, "all", "a", false, "Upgrade every recipe in the layer")
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/Fishwaldo/go-yocto/backends"
+	"github.com/Fishwaldo/go-yocto/output"
 	"github.com/Fishwaldo/go-yocto/parsers"
 	"github.com/Fishwaldo/go-yocto/utils"
 	"github.com/spf13/cobra"
@@ -22,6 +23,10 @@ var rootCmd = &cobra.Command{
 
 var cfgFile string
 
+/* lazyCache is the annotation of commands that start without loading the
+ * backend caches */
+const lazyCache = "lazycache"
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -37,6 +42,19 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.config/go-yocto.yaml)")
+	rootCmd.PersistentFlags().StringP("output", "o", "table", "Output format: table, json or yaml. With json and yaml only results go to stdout")
+	if err := viper.BindPFlag("output.format", rootCmd.PersistentFlags().Lookup("output")); err != nil {
+		utils.Logger.Error("Failed to Bind Flag", utils.Logger.Args("flag", "output", "error", err))
+	}
+	/* the recipe and template commands, and the mappings, all use the layer */
+	rootCmd.PersistentFlags().StringP("layer", "l", ".", "Layer Directory to create and upgrade recipes in, and to look for templates and mappings in")
+	if err := viper.BindPFlag("yocto.layerdirectory", rootCmd.PersistentFlags().Lookup("layer")); err != nil {
+		utils.Logger.Error("Failed to Bind Flag", utils.Logger.Args("flag", "layer", "error", err))
+	}
+	rootCmd.PersistentFlags().StringP("build-dir", "b", "", "Build Directory to read conf/bblayers.conf from")
+	if err := viper.BindPFlag("yocto.builddir", rootCmd.PersistentFlags().Lookup("build-dir")); err != nil {
+		utils.Logger.Error("Failed to Bind Flag", utils.Logger.Args("flag", "build-dir", "error", err))
+	}
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -53,6 +71,11 @@ func initConfig() {
 	viper.AutomaticEnv()
 
 	utils.InitLogger()
+	/* before anything logs, so machine output keeps stdout clean */
+	if err := output.Setup(); err != nil {
+		utils.Logger.Error("Failed to set up output", utils.Logger.Args("error", err))
+		os.Exit(-1)
+	}
 
 	if err := utils.Config.InitConfig(); err != nil {
 		utils.Logger.Error("Failed to initialize Logger", utils.Logger.Args("error", err))
@@ -66,6 +89,10 @@ func initConfig() {
 		utils.Logger.Error("Failed to initialize Parsers", utils.Logger.Args("error", err))
 		os.Exit(-1)
 	}
+	/* commands marked lazyCache load the caches themselves, if at all */
+	if cmd, _, err := rootCmd.Find(os.Args[1:]); err == nil && cmd.Annotations[lazyCache] != "" {
+		return
+	}
 	if err := backends.LoadCache(); err != nil {
 		utils.Logger.Error("Failed to Load Cache", utils.Logger.Args("error", err))
 		os.Exit(-1)
@@ -29,6 +29,10 @@ to quickly create a Cobra application.`,
 func init() {
 	rootCmd.AddCommand(sourceCmd)
 	sourceCmd.AddCommand(cmdSource.SearchCmd)
+	sourceCmd.AddCommand(cmdSource.ShowCmd)
+	sourceCmd.AddCommand(cmdSource.VersionsCmd)
+	/* search reads the search index, and only falls back to the caches */
+	cmdSource.SearchCmd.Annotations = map[string]string{lazyCache: "true"}
 
 
 
@@ -4,41 +4,78 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmdSource
 
 import (
+	"strconv"
+	"strings"
+
 	"github.com/Fishwaldo/go-yocto/backends"
+	"github.com/Fishwaldo/go-yocto/output"
+	"github.com/Fishwaldo/go-yocto/source"
+	"github.com/Fishwaldo/go-yocto/utils"
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
 )
 
+var query source.Query
+
 // searchCmd represents the search command
 var SearchCmd = &cobra.Command{
-	Use:   "search",
+	Use:   "search [keywords]",
 	Short: "Search For Sources accross all packages",
-	Long: `search for sources accross all packages`,
-	Args: cobra.ExactArgs(1),
+	Long: `Search for sources accross all packages.
+
+Every keyword has to match the name, identifier, topics, summary or
+description of a source. Matches in the name count most, and small typos
+are forgiven. Results are ranked by how well they match, unless --sort
+says otherwise.
+
+The keywords may be left out when a filter is given, to list everything
+in a section or with a topic.
+
+The search index written by cache update is used, so the backend caches
+are not loaded. Without an index the backends are searched directly,
+which is slower.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := cobra.MaximumNArgs(1)(cmd, args); err != nil {
+			return err
+		}
+		if len(args) == 0 && query.Section == "" && query.Topic == "" && query.Backend == "" {
+			return cobra.ExactArgs(1)(cmd, args)
+		}
+		return nil
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		sources, err := backends.SearchSource("", args[0])
-		if err == nil {
-			td := pterm.TableData{{"Name", "Description", "Backend", "Url"}}
-			for _, source := range sources {
-				td = append(td, []string{source.Name, source.Description, source.BackendID, source.Url})
+		q := query
+		q.Keywords = strings.Join(args, " ")
+		matches, err := backends.SearchSource(q)
+		if err != nil {
+			utils.Logger.Error("Failed to search", utils.Logger.Args("error", err))
+			return
+		}
+		if output.Machine() {
+			records := []source.Record{}
+			for _, m := range matches {
+				records = append(records, m.Source.Record())
+			}
+			if err := output.Write(records); err != nil {
+				utils.Logger.Error("Failed to write results", utils.Logger.Args("error", err))
 			}
-			pterm.DefaultTable.WithHasHeader().WithData(
-				td,
-			).Render()
+			return
 		}
+		td := pterm.TableData{{"Name", "Identifier", "Section", "Description", "Backend", "Url", "Score"}}
+		for _, m := range matches {
+			td = append(td, []string{m.Source.Name, m.Source.Identifier, m.Source.Section, m.Source.Description, m.Source.BackendID, m.Source.Url, strconv.Itoa(m.Score)})
+		}
+		pterm.DefaultTable.WithHasHeader().WithData(
+			td,
+		).Render()
 	},
 }
 
 func init() {
-
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// searchCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// searchCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	SearchCmd.Flags().StringVar(&query.Backend, "backend", "", "Only search this backend")
+	SearchCmd.Flags().StringVarP(&query.Section, "section", "s", "", "Only sources in this section or release group, eg frameworks")
+	SearchCmd.Flags().StringVarP(&query.Topic, "topic", "t", "", "Only sources with this topic")
+	SearchCmd.Flags().BoolVar(&query.ActiveOnly, "active", false, "Only sources whose repository is active")
+	SearchCmd.Flags().IntVarP(&query.Limit, "limit", "n", 0, "Show at most this many results, 0 for all")
+	SearchCmd.Flags().StringVar(&query.Sort, "sort", source.SortScore, "Sort by score, name, identifier or backend")
 }
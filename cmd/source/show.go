@@ -0,0 +1,139 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmdSource
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/backends"
+	"github.com/Fishwaldo/go-yocto/output"
+	"github.com/Fishwaldo/go-yocto/source"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var offline bool
+
+// ShowCmd represents the show command
+var ShowCmd = &cobra.Command{
+	Use:   "show <backend> <identifier>",
+	Short: "Show everything known about a source",
+	Long: `Show everything known about a source before creating a recipe for it:
+its repository, the branch the branch rules pick, the AppStream summary,
+description and releases, the tarballs that can be downloaded, its
+dependencies and what depends on it, and its bug tracker.
+
+All of that comes from the caches. The licenses are then fetched from the
+repository, unless --offline is given.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, ok := backends.Backends[args[0]]
+		if !ok {
+			utils.Logger.Error("Backend not found", utils.Logger.Args("backend", args[0]))
+			return
+		}
+		if !b.Ready() {
+			utils.Logger.Error("Backend not ready", utils.Logger.Args("backend", args[0]))
+			return
+		}
+		d, err := b.Details(args[1])
+		if err != nil {
+			utils.Logger.Error("Failed to get details", utils.Logger.Args("backend", args[0], "identifier", args[1], "error", err))
+			return
+		}
+		if output.Machine() {
+			if !offline {
+				fetchDetails(b, d)
+			}
+			if err := output.Write(d); err != nil {
+				utils.Logger.Error("Failed to write results", utils.Logger.Args("error", err))
+			}
+			return
+		}
+		showDetails(d)
+		if offline {
+			return
+		}
+		if err := fetchDetails(b, d); err == nil {
+			pterm.DefaultSection.WithLevel(2).Println("Licenses")
+			pterm.Println(list(d.Licenses))
+		}
+	},
+}
+
+/* fetchDetails fetches the details that need the network, a failure only
+ * loses those */
+func fetchDetails(b backends.Backend, d *source.Details) error {
+	spinner, _ := pterm.DefaultSpinner.Start("Fetching licenses for " + d.Identifier)
+	if err := b.FetchDetails(d); err != nil {
+		spinner.Warning("Could not fetch licenses: " + err.Error())
+		return err
+	}
+	spinner.Success()
+	return nil
+}
+
+func showDetails(d *source.Details) {
+	pterm.DefaultSection.Println(d.Name + " (" + d.Identifier + ")")
+	td := pterm.TableData{
+		{"Backend", d.Backend},
+		{"Repopath", d.Repopath},
+		{"Active", strconv.FormatBool(d.Active)},
+		{"Branch", d.Branch},
+		{"Url", d.URL},
+		{"Bugzilla", d.Bugzilla},
+		{"Topics", strings.Join(d.Topics, " ")},
+		{"Description", d.Description},
+		{"Summary", d.Summary},
+	}
+	pterm.DefaultTable.WithData(td).Render()
+	if d.AppStreamDescription != "" {
+		pterm.DefaultSection.WithLevel(2).Println("AppStream Description")
+		pterm.DefaultParagraph.Println(d.AppStreamDescription)
+	}
+
+	pterm.DefaultSection.WithLevel(2).Println("Releases")
+	if len(d.Releases) == 0 {
+		pterm.Println("none")
+	} else {
+		td = pterm.TableData{{"Version", "Date", "Prerelease", "Origin"}}
+		for _, r := range d.Releases {
+			date := ""
+			if !r.Date.IsZero() {
+				date = r.Date.Format("2006-01-02")
+			}
+			td = append(td, []string{r.Version, date, strconv.FormatBool(r.Prerelease), r.Origin})
+		}
+		pterm.DefaultTable.WithHasHeader().WithData(td).Render()
+	}
+
+	pterm.DefaultSection.WithLevel(2).Println("Downloads")
+	if len(d.Downloads) == 0 {
+		pterm.Println("none")
+	} else {
+		td = pterm.TableData{{"Version", "Date", "Url"}}
+		for _, dl := range d.Downloads {
+			td = append(td, []string{dl.Version, dl.Date, dl.URL})
+		}
+		pterm.DefaultTable.WithHasHeader().WithData(td).Render()
+	}
+
+	pterm.DefaultSection.WithLevel(2).Println("Depends")
+	pterm.Println(list(d.Depends))
+	pterm.DefaultSection.WithLevel(2).Println("Reverse Depends")
+	pterm.Println(list(d.ReverseDepends))
+}
+
+func list(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, "\n")
+}
+
+func init() {
+	ShowCmd.Flags().BoolVar(&offline, "offline", false, "Only show what is in the caches, do not fetch the licenses")
+}
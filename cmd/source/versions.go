@@ -0,0 +1,137 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmdSource
+
+import (
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/backends"
+	"github.com/Fishwaldo/go-yocto/output"
+	"github.com/Fishwaldo/go-yocto/recipe"
+	"github.com/Fishwaldo/go-yocto/source"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var constraint string
+
+/* VersionInfo is a version of a source as listed by source versions */
+type VersionInfo struct {
+	Version   string   `json:"version" yaml:"version"`
+	Channel   string   `json:"channel" yaml:"channel"`
+	Published string   `json:"published,omitempty" yaml:"published,omitempty"`
+	Announced string   `json:"announced,omitempty" yaml:"announced,omitempty"`
+	Origin    string   `json:"origin" yaml:"origin"`
+	Layers    []string `json:"layers" yaml:"layers"`
+	Selected  bool     `json:"selected" yaml:"selected"`
+}
+
+// VersionsCmd represents the versions command
+var VersionsCmd = &cobra.Command{
+	Use:   "versions <backend> <identifier>",
+	Short: "List the upstream versions of a source",
+	Long: `List the upstream versions of a source, newest first.
+
+Versions from the stable download directories are marked stable, those
+from the unstable ones unstable. The date AppStream announced a release on
+is shown next to the date its tarball was published, and versions only
+announced in AppStream have no tarball to build. Versions carried by a
+recipe in the scanned layers are marked with the layer.
+
+--constraint marks the newest version that satisfies it, eg ~5.104 for the
+newest 5.104.x or ">= 23.04, < 23.08". The same constraint can be given to
+recipe create --version to pick that version.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, ok := backends.Backends[args[0]]
+		if !ok {
+			utils.Logger.Error("Backend not found", utils.Logger.Args("backend", args[0]))
+			return
+		}
+		if !b.Ready() {
+			utils.Logger.Error("Backend not ready", utils.Logger.Args("backend", args[0]))
+			return
+		}
+		releases, err := b.Releases(args[1])
+		if err != nil {
+			utils.Logger.Error("Failed to get releases", utils.Logger.Args("backend", args[0], "identifier", args[1], "error", err))
+			return
+		}
+		selected := ""
+		if constraint != "" {
+			var downloads []source.Release
+			for _, r := range releases {
+				if r.Origin != "appstream" {
+					downloads = append(downloads, r)
+				}
+			}
+			r, err := source.SelectVersion(downloads, constraint)
+			if err != nil {
+				utils.Logger.Error("No version satisfies the constraint", utils.Logger.Args("identifier", args[1], "constraint", constraint, "error", err))
+				return
+			}
+			selected = r.Version
+		}
+		/* the layers are only needed to mark versions, carry on without them */
+		layers := make(map[string][]string)
+		if err := recipe.ScanLayers(); err != nil {
+			utils.Logger.Warn("Failed to scan layers", utils.Logger.Args("error", err))
+		} else if e, ok := recipe.ExistingRecipes().Lookup(args[1]); ok {
+			layers = e.Layers()
+		}
+
+		versions := []VersionInfo{}
+		for i := len(releases) - 1; i >= 0; i-- {
+			r := releases[i]
+			v := VersionInfo{
+				Version:   r.Version,
+				Channel:   "stable",
+				Published: date(r),
+				Origin:    r.Origin,
+				Layers:    append([]string{}, layers[r.Version]...),
+				Selected:  r.Version == selected,
+			}
+			if r.Prerelease {
+				v.Channel = "unstable"
+			}
+			if !r.Announced.IsZero() {
+				v.Announced = r.Announced.Format("2006-01-02")
+			}
+			if r.Origin == "appstream" {
+				v.Published = ""
+			}
+			versions = append(versions, v)
+		}
+		if output.Machine() {
+			if err := output.Write(versions); err != nil {
+				utils.Logger.Error("Failed to write results", utils.Logger.Args("error", err))
+			}
+			return
+		}
+		td := pterm.TableData{{"Version", "Channel", "Published", "Announced", "Origin", "Layer", "Selected"}}
+		for _, v := range versions {
+			mark := ""
+			if v.Selected {
+				mark = "*"
+			}
+			td = append(td, []string{v.Version, v.Channel, v.Published, v.Announced, v.Origin, strings.Join(v.Layers, " "), mark})
+		}
+		pterm.DefaultTable.WithHasHeader().WithData(td).Render()
+		if selected != "" {
+			pterm.Info.Println(constraint + " selects " + selected)
+		}
+	},
+}
+
+func date(r source.Release) string {
+	if r.Date.IsZero() {
+		return ""
+	}
+	return r.Date.Format("2006-01-02")
+}
+
+func init() {
+	VersionsCmd.Flags().StringVarP(&constraint, "constraint", "c", "", "Mark the newest version satisfying a constraint, eg ~5.104")
+}
@@ -0,0 +1,27 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/Fishwaldo/go-yocto/cmd/template"
+	"github.com/spf13/cobra"
+)
+
+// templateCmd represents the template command
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Inspect the recipe templates",
+	Long: `Inspect the templates recipes are rendered from.
+
+Templates are looked up in the builtin defaults, the user template
+directory and the templates directory of the layer, each followed by a
+subdirectory named after the backend. Later directories take precedence.
+Files named _name.tmpl are partials, shared as {{template "name" .}}.`,
+}
+
+func init() {
+	rootCmd.AddCommand(templateCmd)
+	templateCmd.AddCommand(cmdTemplate.ListCmd)
+	templateCmd.AddCommand(cmdTemplate.ShowCmd)
+}
@@ -0,0 +1,38 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmdTemplate
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/output"
+	"github.com/Fishwaldo/go-yocto/templates"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// ListCmd represents the template list command
+var ListCmd = &cobra.Command{
+	Use:   "list [backend]",
+	Short: "List the templates and which file is used",
+	Long: `List the templates on the search path, the file that is used for
+each one and the files it overrides`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		backend := ""
+		if len(args) > 0 {
+			backend = args[0]
+		}
+		td := pterm.TableData{{"Template", "Partial", "Origin", "File", "Overrides"}}
+		for _, e := range templates.List(backend) {
+			var shadowed []string
+			for _, f := range e.Shadowed {
+				shadowed = append(shadowed, f.Path)
+			}
+			td = append(td, []string{e.Name, strconv.FormatBool(e.Partial), e.Origin, e.Path, strings.Join(shadowed, " ")})
+		}
+		output.Render(td)
+	},
+}
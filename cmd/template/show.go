@@ -0,0 +1,46 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmdTemplate
+
+import (
+	"fmt"
+
+	"github.com/Fishwaldo/go-yocto/output"
+	"github.com/Fishwaldo/go-yocto/templates"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// ShowCmd represents the template show command
+var ShowCmd = &cobra.Command{
+	Use:   "show <template> [backend]",
+	Short: "Show the template that is used",
+	Long:  `Show where a template is loaded from and print its content`,
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		backend := ""
+		if len(args) > 1 {
+			backend = args[1]
+		}
+		e, ok := templates.Lookup(args[0], backend)
+		if !ok {
+			utils.Logger.Error("Template not found", utils.Logger.Args("template", args[0]))
+			return
+		}
+		content, err := templates.Read(e.Name, backend)
+		if err != nil {
+			utils.Logger.Error("Failed to read template", utils.Logger.Args("template", e.Path, "error", err))
+			return
+		}
+		/* only the template itself is output for scripts */
+		if !output.Machine() {
+			pterm.Info.Printfln("%s from %s (%s)", e.Name, e.Path, e.Origin)
+			for _, f := range e.Shadowed {
+				pterm.Info.Printfln("overrides %s (%s)", f.Path, f.Origin)
+			}
+		}
+		fmt.Print(string(content))
+	},
+}
@@ -3,6 +3,7 @@ module github.com/Fishwaldo/go-yocto
 go 1.18
 
 require (
+	atomicgo.dev/cursor v0.1.1
 	github.com/Masterminds/semver/v3 v3.2.1
 	github.com/davecgh/go-spew v1.1.1
 	github.com/go-git/go-git/v5 v5.6.1
@@ -15,7 +16,6 @@ require (
 )
 
 require (
-	atomicgo.dev/cursor v0.1.1 // indirect
 	atomicgo.dev/keyboard v0.2.9 // indirect
 	atomicgo.dev/schedule v0.0.2 // indirect
 	github.com/Microsoft/go-winio v0.5.2 // indirect
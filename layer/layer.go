@@ -0,0 +1,190 @@
+package layer
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/parsers/bitbake"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/spf13/viper"
+)
+
+/* Layer is a Yocto layer and the settings from its conf/layer.conf */
+type Layer struct {
+	Path         string
+	Collection   string
+	Priority     int
+	BBFiles      []string
+	SeriesCompat []string
+	HasConf      bool
+}
+
+/* Discover returns the layers to scan. When a build directory is
+ * configured the layers come from its conf/bblayers.conf, otherwise from
+ * the yocto.layers setting */
+func Discover() (layers []Layer, err error) {
+	var dirs []string
+	if builddir := viper.GetString("yocto.builddir"); builddir != "" {
+		dirs, err = readBBLayers(builddir)
+		if err != nil {
+			utils.Logger.Error("Failed to read bblayers.conf", utils.Logger.Args("builddir", builddir, "error", err))
+			return nil, err
+		}
+	} else {
+		dirs = viper.GetStringSlice("yocto.layers")
+	}
+
+	var dynamic []string
+	collections := make(map[string]bool)
+	for _, dir := range dirs {
+		l, dyn, err := readLayerConf(dir)
+		if err != nil {
+			utils.Logger.Error("Failed to read layer.conf", utils.Logger.Args("layer", dir, "error", err))
+			return nil, err
+		}
+		if l.Collection != "" {
+			collections[l.Collection] = true
+		}
+		dynamic = append(dynamic, dyn...)
+		layers = append(layers, l)
+	}
+
+	/* BBFILES_DYNAMIC entries only apply when the named collection is
+	 * part of the build, or absent when prefixed with ! */
+	for _, d := range dynamic {
+		owner, entry, _ := strings.Cut(d, "\x00")
+		coll, pattern, ok := strings.Cut(entry, ":")
+		if !ok {
+			continue
+		}
+		want := true
+		if strings.HasPrefix(coll, "!") {
+			coll = strings.TrimPrefix(coll, "!")
+			want = false
+		}
+		if collections[coll] != want {
+			continue
+		}
+		for i := range layers {
+			if layers[i].Path == owner {
+				layers[i].BBFiles = append(layers[i].BBFiles, pattern)
+			}
+		}
+	}
+
+	if series := viper.GetString("yocto.layerseries"); series != "" {
+		for _, l := range layers {
+			if l.HasConf && !contains(l.SeriesCompat, series) {
+				utils.Logger.Warn("Layer is not compatible with series", utils.Logger.Args("layer", l.Path, "series", series, "compat", strings.Join(l.SeriesCompat, " ")))
+			}
+		}
+	}
+	return layers, nil
+}
+
+/* Paths returns the directories of the discovered layers, which is also
+ * the BBPATH used to resolve require and include statements */
+func Paths(layers []Layer) (paths []string) {
+	for _, l := range layers {
+		paths = append(paths, l.Path)
+	}
+	return paths
+}
+
+func readBBLayers(builddir string) ([]string, error) {
+	builddir, err := filepath.Abs(builddir)
+	if err != nil {
+		return nil, err
+	}
+	r, err := bitbake.ParseConf(path.Join(builddir, "conf", "bblayers.conf"), map[string]string{"TOPDIR": builddir}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, d := range bitbake.Fields(r.Get("BBLAYERS")) {
+		/* python expressions and variables set outside bblayers.conf,
+		 * eg by the setup script, cannot be expanded here */
+		if bitbake.Unexpanded(d) {
+			utils.Logger.Warn("Skipping layer that cannot be expanded", utils.Logger.Args("file", r.File, "layer", d))
+			continue
+		}
+		dirs = append(dirs, path.Clean(d))
+	}
+	if len(dirs) == 0 {
+		return nil, errors.New("no layers in BBLAYERS")
+	}
+	return dirs, nil
+}
+
+/* readLayerConf reads BBFILES, BBFILE_PRIORITY and LAYERSERIES_COMPAT from
+ * a layers conf/layer.conf. BBFILES_DYNAMIC entries are returned separately,
+ * tagged with the layer path, as they depend on the other layers */
+func readLayerConf(dir string) (l Layer, dynamic []string, err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return l, nil, err
+	}
+	l = Layer{Path: dir}
+	conf := path.Join(dir, "conf", "layer.conf")
+	if _, err := os.Stat(conf); errors.Is(err, os.ErrNotExist) {
+		utils.Logger.Trace("No layer.conf, scanning recipes-* directories", utils.Logger.Args("layer", dir))
+		return l, nil, nil
+	}
+	r, err := bitbake.ParseConf(conf, map[string]string{"LAYERDIR": dir}, nil)
+	if err != nil {
+		return l, nil, err
+	}
+	l.HasConf = true
+	l.BBFiles = strings.Fields(r.Get("BBFILES"))
+	if colls := strings.Fields(r.Get("BBFILE_COLLECTIONS")); len(colls) > 0 {
+		l.Collection = colls[0]
+		if p := r.Get("BBFILE_PRIORITY_" + l.Collection); p != "" {
+			if l.Priority, err = strconv.Atoi(p); err != nil {
+				utils.Logger.Warn("Invalid BBFILE_PRIORITY", utils.Logger.Args("layer", dir, "priority", p))
+				l.Priority = 0
+			}
+		}
+		l.SeriesCompat = strings.Fields(r.Get("LAYERSERIES_COMPAT_" + l.Collection))
+	}
+	for _, d := range strings.Fields(r.Get("BBFILES_DYNAMIC")) {
+		dynamic = append(dynamic, dir+"\x00"+d)
+	}
+	return l, dynamic, nil
+}
+
+/* Files expands the layers BBFILES patterns into the .bb and .bbappend
+ * files bitbake would parse */
+func (l Layer) Files() (files []string) {
+	seen := make(map[string]bool)
+	for _, pattern := range l.BBFiles {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			utils.Logger.Warn("Invalid BBFILES pattern", utils.Logger.Args("layer", l.Path, "pattern", pattern, "error", err))
+			continue
+		}
+		for _, m := range matches {
+			if seen[m] {
+				continue
+			}
+			if ext := path.Ext(m); ext != ".bb" && ext != ".bbappend" {
+				continue
+			}
+			seen[m] = true
+			files = append(files, m)
+		}
+	}
+	return files
+}
+
+func contains(list []string, v string) bool {
+	for _, l := range list {
+		if l == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,254 @@
+package mapping
+
+import (
+	_ "embed"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Fishwaldo/go-yocto/layer"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+/* Entry describes how an upstream dependency is satisfied in Yocto */
+type Entry struct {
+	Recipe  string `yaml:"recipe,omitempty"`
+	Inherit string `yaml:"inherit,omitempty"`
+	Native  bool   `yaml:"native,omitempty"`
+	Ignore  bool   `yaml:"ignore,omitempty"`
+}
+
+/* Result is a resolved mapping along with where it came from */
+type Result struct {
+	Entry
+	Key    string
+	Source string
+}
+
+type mappingFile struct {
+	Mappings map[string]Entry `yaml:"mappings"`
+}
+
+type mappingLayer struct {
+	Name     string
+	File     string
+	Mappings map[string]Entry
+}
+
+//go:embed defaults.yaml
+var defaults []byte
+
+var (
+	layers   []mappingLayer
+	loadOnce sync.Once
+)
+
+func init() {
+	viper.SetDefault("mapping.userfile", "$HOME/.config/go-yocto-mapping.yaml")
+	viper.SetDefault("mapping.layerfile", "conf/go-yocto-mapping.yaml")
+}
+
+/* load reads the mappings the first time they are needed, so commands
+ * that resolve no dependancies never discover the layers */
+func load() {
+	loadOnce.Do(func() {
+		if err := Load(); err != nil {
+			utils.Logger.Error("Failed to Load Mappings", utils.Logger.Args("error", err))
+		}
+	})
+}
+
+/* Load reads the built-in mappings, then the user mapping file and finally
+ * the mapping file of each configured layer. Later files take precedence.
+ * Layers that cannot be discovered only lose their mapping files */
+func Load() (err error) {
+	utils.Logger.Trace("Loading Dependency Mappings")
+	layers = nil
+
+	def, err := builtin()
+	if err != nil {
+		return err
+	}
+	layers = append(layers, mappingLayer{Name: "builtin", Mappings: def})
+
+	if err := loadFile("user", os.ExpandEnv(viper.GetString("mapping.userfile"))); err != nil {
+		return err
+	}
+
+	ls, err := layer.Discover()
+	if err != nil {
+		utils.Logger.Warn("Failed to discover layers, their mappings are skipped", utils.Logger.Args("error", err))
+	}
+	dirs := layer.Paths(ls)
+	if ld := viper.GetString("yocto.layerdirectory"); ld != "" {
+		dirs = append(dirs, ld)
+	}
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil || seen[abs] {
+			continue
+		}
+		seen[abs] = true
+		if err := loadFile(path.Base(abs), path.Join(abs, viper.GetString("mapping.layerfile"))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func builtin() (map[string]Entry, error) {
+	var def mappingFile
+	if err := yaml.Unmarshal(defaults, &def); err != nil {
+		utils.Logger.Error("Failed to unmarshal builtin mappings", utils.Logger.Args("error", err))
+		return nil, err
+	}
+	return def.Mappings, nil
+}
+
+/* Builtin returns the built-in mappings that name a recipe, without the
+ * user and layer files, so other tables can build on them rather than
+ * repeat them */
+func Builtin() (results []Result, err error) {
+	def, err := builtin()
+	if err != nil {
+		return nil, err
+	}
+	for k, e := range def {
+		if e.Ignore || e.Recipe == "" || strings.ContainsAny(k, "*?[") {
+			continue
+		}
+		results = append(results, Result{Entry: e, Key: k, Source: "builtin"})
+	}
+	sort.Slice(results, func(a, b int) bool { return results[a].Key < results[b].Key })
+	return results, nil
+}
+
+func loadFile(name string, file string) error {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			utils.Logger.Trace("No mapping file", utils.Logger.Args("file", file))
+			return nil
+		}
+		utils.Logger.Error("Failed to read mapping file", utils.Logger.Args("file", file, "error", err))
+		return err
+	}
+	var mf mappingFile
+	if err := yaml.Unmarshal(raw, &mf); err != nil {
+		utils.Logger.Error("Failed to unmarshal mapping file", utils.Logger.Args("file", file, "error", err))
+		return err
+	}
+	utils.Logger.Trace("Loaded mapping file", utils.Logger.Args("file", file, "entries", len(mf.Mappings)))
+	layers = append(layers, mappingLayer{Name: name, File: file, Mappings: mf.Mappings})
+	return nil
+}
+
+/* Lookup finds the mapping for an upstream dependency. Exact keys win over
+ * glob patterns, and later layers win over earlier ones */
+func Lookup(key string) (Result, bool) {
+	load()
+	for i := len(layers) - 1; i >= 0; i-- {
+		if e, ok := layers[i].Mappings[key]; ok {
+			return Result{Entry: e, Key: key, Source: layers[i].source()}, true
+		}
+	}
+	for i := len(layers) - 1; i >= 0; i-- {
+		var patterns []string
+		for k := range layers[i].Mappings {
+			if strings.ContainsAny(k, "*?[") {
+				patterns = append(patterns, k)
+			}
+		}
+		/* most specific pattern first */
+		sort.Slice(patterns, func(a, b int) bool { return len(patterns[a]) > len(patterns[b]) })
+		for _, p := range patterns {
+			if ok, _ := filepath.Match(p, key); ok {
+				return Result{Entry: layers[i].Mappings[p], Key: p, Source: layers[i].source()}, true
+			}
+		}
+	}
+	return Result{}, false
+}
+
+/* List returns the effective mappings, one per key */
+func List() (results []Result) {
+	load()
+	keys := make(map[string]bool)
+	for _, l := range layers {
+		for k := range l.Mappings {
+			keys[k] = true
+		}
+	}
+	for k := range keys {
+		for i := len(layers) - 1; i >= 0; i-- {
+			if e, ok := layers[i].Mappings[k]; ok {
+				results = append(results, Result{Entry: e, Key: k, Source: layers[i].source()})
+				break
+			}
+		}
+	}
+	sort.Slice(results, func(a, b int) bool { return results[a].Key < results[b].Key })
+	return results
+}
+
+/* Depend returns the recipe to add to DEPENDS, if any */
+func (e Entry) Depend() string {
+	if e.Ignore || e.Recipe == "" {
+		return ""
+	}
+	if e.Native && !strings.HasSuffix(e.Recipe, "-native") {
+		return e.Recipe + "-native"
+	}
+	return e.Recipe
+}
+
+func (l mappingLayer) source() string {
+	if l.File == "" {
+		return l.Name
+	}
+	return l.Name + " (" + l.File + ")"
+}
+
+/* SaveLayerMappings adds entries to the mapping file of a layer, creating
+ * it if needed, and returns the file written */
+func SaveLayerMappings(layerdir string, entries map[string]Entry) (string, error) {
+	file, out, err := MergeLayerMappings(layerdir, entries)
+	if err != nil {
+		return file, err
+	}
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		return file, err
+	}
+	return file, os.WriteFile(file, out, 0644)
+}
+
+/* MergeLayerMappings returns the mapping file of a layer and what it would
+ * hold with entries added, without writing it */
+func MergeLayerMappings(layerdir string, entries map[string]Entry) (string, []byte, error) {
+	file := path.Join(layerdir, viper.GetString("mapping.layerfile"))
+	var mf mappingFile
+	raw, err := os.ReadFile(file)
+	if err == nil {
+		if err := yaml.Unmarshal(raw, &mf); err != nil {
+			utils.Logger.Error("Failed to unmarshal mapping file", utils.Logger.Args("file", file, "error", err))
+			return file, nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return file, nil, err
+	}
+	if mf.Mappings == nil {
+		mf.Mappings = make(map[string]Entry)
+	}
+	for k, e := range entries {
+		mf.Mappings[k] = e
+	}
+	out, err := yaml.Marshal(&mf)
+	return file, out, err
+}
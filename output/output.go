@@ -0,0 +1,100 @@
+package output
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+
+	"atomicgo.dev/cursor"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/pterm/pterm"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	Table = "table"
+	JSON  = "json"
+	YAML  = "yaml"
+)
+
+func init() {
+	viper.SetDefault("output.format", Table)
+}
+
+/* Format returns the output format asked for with --output */
+func Format() string {
+	return strings.ToLower(viper.GetString("output.format"))
+}
+
+/* Machine reports if results are written for scripts rather than people */
+func Machine() bool {
+	switch Format() {
+	case JSON, YAML:
+		return true
+	}
+	return false
+}
+
+/* Setup checks the output format. In machine mode everything meant for
+ * people, the log, spinners, progress bars and tables, goes to stderr so
+ * stdout only carries the results */
+func Setup() error {
+	switch Format() {
+	case Table, "":
+		return nil
+	case JSON, YAML:
+		pterm.SetDefaultOutput(os.Stderr)
+		/* spinners hide the cursor with escapes of their own */
+		cursor.SetTarget(os.Stderr)
+		utils.Logger = utils.Logger.WithWriter(os.Stderr)
+		return nil
+	}
+	return errors.New("unknown output format " + Format() + ", use json, yaml or table")
+}
+
+/* Write writes results to stdout in the machine format */
+func Write(v interface{}) error {
+	switch Format() {
+	case JSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case YAML:
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+	return errors.New("output format " + Format() + " is not a machine format")
+}
+
+/* Render renders a table with a header row for people, or in machine mode
+ * writes its rows as a list of objects keyed by the header, lower cased
+ * and with spaces replaced by underscores */
+func Render(td pterm.TableData) error {
+	if !Machine() {
+		return pterm.DefaultTable.WithHasHeader().WithData(td).Render()
+	}
+	rows := []map[string]string{}
+	if len(td) == 0 {
+		return Write(rows)
+	}
+	var keys []string
+	for _, h := range td[0] {
+		keys = append(keys, strings.ReplaceAll(strings.ToLower(h), " ", "_"))
+	}
+	for _, row := range td[1:] {
+		m := make(map[string]string)
+		for i, v := range row {
+			if i < len(keys) {
+				m[keys[i]] = v
+			}
+		}
+		rows = append(rows, m)
+	}
+	return Write(rows)
+}
@@ -88,7 +88,10 @@ func (k *AppStreamParser) Parse(data io.Reader) (metadata map[string]interface{}
 				}
 			}
 			var releases []*semver.Version
+			dates := make(map[string]interface{})
 			for _, v := range as.Releases {
+				/* keep every release and its date, including prereleases */
+				dates[v.Version] = v.Date
 				ver, err := semver.NewVersion(v.Version)
 				if err != nil {
 					utils.Logger.Error("Failed to parse version", utils.Logger.Args("version", v.Version, "error", err))
@@ -104,6 +107,9 @@ func (k *AppStreamParser) Parse(data io.Reader) (metadata map[string]interface{}
 				sort.Sort(semver.Collection(releases))
 				metadata["version"] = releases[len(releases)-1].Original()
 			}
+			if len(dates) > 0 {
+				metadata["releases"] = dates
+			}
 		}
 	}
 	return metadata, nil
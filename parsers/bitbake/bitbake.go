@@ -0,0 +1,520 @@
+package bitbake
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/utils"
+)
+
+/* Recipe holds the variables and classes collected from a BitBake file and
+ * everything it requires or includes */
+type Recipe struct {
+	File     string
+	Inherits []string
+	Includes []string
+	vars     map[string]string
+	weak     map[string]string
+	appends  map[string][]string
+	prepends map[string][]string
+	removes  map[string][]string
+}
+
+type BitBakeParser struct {
+	ready bool
+}
+
+var (
+	assignment = regexp.MustCompile(`^(?:export\s+)?([A-Za-z0-9_\-\.\+\$\{\}/~:]+)(\[[A-Za-z0-9_\-\.]+\])?\s*(\?\?=|\?=|:=|\+=|=\+|\.=|=\.|=)\s*(.*)$`)
+	directive  = regexp.MustCompile(`^(inherit|inherit_defer|require|include|include_all)\s+(.+)$`)
+	function   = regexp.MustCompile(`^(?:python\s+|fakeroot\s+)*[A-Za-z0-9_\-\.\$\{\}:]*\s*\(\)\s*\{\s*$`)
+	pydef      = regexp.MustCompile(`^def\s+`)
+	variable   = regexp.MustCompile(`\$\{([A-Za-z0-9_\-\.\+/~:]+)(\[[A-Za-z0-9_\-\.]+\])?\}`)
+	fileparts  = regexp.MustCompile(`^(.*?)(?:_(.*))?\.(bb|bbappend|inc|bbclass|conf)$`)
+	maxdepth   = 10
+)
+
+func NewParser() *BitBakeParser {
+	return &BitBakeParser{}
+}
+
+func (k *BitBakeParser) GetName() string {
+	return "BitBake"
+}
+
+func (k *BitBakeParser) Init() error {
+	utils.Logger.Trace("Initializing BitBake Parser")
+	k.ready = true
+	return nil
+}
+
+func (k *BitBakeParser) Ready() bool {
+	return k.ready
+}
+
+/* Parse reads a single BitBake file without following require or include
+ * statements, returning its expanded variables and inherits */
+func (k *BitBakeParser) Parse(data io.Reader) (metadata map[string]interface{}, err error) {
+	metadata = make(map[string]interface{})
+	r := NewRecipe("")
+	if err := r.parse(data, "", nil, 0); err != nil {
+		utils.Logger.Error("Failed to parse bitbake file", utils.Logger.Args("error", err))
+		return metadata, err
+	}
+	metadata["variables"] = r.Variables()
+	metadata["inherits"] = r.Inherits
+	return metadata, nil
+}
+
+/* NewRecipe returns an empty recipe with the filename derived variables
+ * (PN, PV, BPN, P, ...) that BitBake sets before parsing */
+func NewRecipe(file string) *Recipe {
+	r := &Recipe{
+		File:     file,
+		vars:     make(map[string]string),
+		weak:     make(map[string]string),
+		appends:  make(map[string][]string),
+		prepends: make(map[string][]string),
+		removes:  make(map[string][]string),
+	}
+	if file == "" {
+		return r
+	}
+	pn, pv := SplitFileName(path.Base(file))
+	r.vars["FILE"] = file
+	r.vars["FILE_DIRNAME"] = path.Dir(file)
+	r.vars["THISDIR"] = path.Dir(file)
+	r.vars["PN"] = pn
+	r.vars["PV"] = pv
+	r.vars["PR"] = "r0"
+	r.vars["P"] = "${PN}-${PV}"
+	r.vars["BP"] = "${BPN}-${PV}"
+	r.vars["PF"] = "${PN}-${PV}-${PR}"
+	r.vars["BPN"] = strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(pn, "nativesdk-"), "-native"), "-cross")
+	return r
+}
+
+/* SplitFileName splits foo_1.2.bb into foo and 1.2. PV defaults to 1.0
+ * just like BitBake when the file name carries no version */
+func SplitFileName(name string) (pn string, pv string) {
+	m := fileparts.FindStringSubmatch(name)
+	if m == nil {
+		return name, "1.0"
+	}
+	if m[2] == "" {
+		return m[1], "1.0"
+	}
+	return m[1], m[2]
+}
+
+/* ParseFile parses a BitBake file, following require and include
+ * statements. Relative includes are searched for next to the including
+ * file and then in each directory of bbpath */
+func ParseFile(file string, bbpath []string) (*Recipe, error) {
+	r := NewRecipe(file)
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := r.parse(f, path.Dir(file), bbpath, 0); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+/* ParseConf parses a configuration file such as bblayers.conf or
+ * layer.conf, seeding the given variables (eg LAYERDIR) first */
+func ParseConf(file string, vars map[string]string, bbpath []string) (*Recipe, error) {
+	r := NewRecipe("")
+	r.File = file
+	for k, v := range vars {
+		r.vars[k] = v
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := r.parse(f, path.Dir(file), bbpath, 0); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+/* ParseInto parses another file, such as a bbappend, on top of an already
+ * parsed recipe */
+func (r *Recipe) ParseInto(file string, bbpath []string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r.Includes = append(r.Includes, file)
+	return r.parse(f, path.Dir(file), bbpath, 0)
+}
+
+func (r *Recipe) parse(data io.Reader, dir string, bbpath []string, depth int) error {
+	if depth > maxdepth {
+		return errors.New("include nesting too deep")
+	}
+	scanner := bufio.NewScanner(data)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var line string
+	infunc := false
+	indef := false
+	for scanner.Scan() {
+		text := scanner.Text()
+		if infunc {
+			if strings.TrimRight(text, " \t") == "}" {
+				infunc = false
+			}
+			continue
+		}
+		if indef {
+			if len(text) > 0 && (text[0] == ' ' || text[0] == '\t') || strings.TrimSpace(text) == "" {
+				continue
+			}
+			indef = false
+		}
+		if strings.HasSuffix(text, "\\") {
+			line += strings.TrimSuffix(text, "\\")
+			continue
+		}
+		line += text
+		stmt := strings.TrimSpace(line)
+		line = ""
+		if stmt == "" || strings.HasPrefix(stmt, "#") {
+			continue
+		}
+		if function.MatchString(stmt) {
+			infunc = true
+			continue
+		}
+		if pydef.MatchString(stmt) {
+			indef = true
+			continue
+		}
+		if m := directive.FindStringSubmatch(stmt); m != nil {
+			if err := r.directive(m[1], m[2], dir, bbpath, depth); err != nil {
+				return err
+			}
+			continue
+		}
+		if m := assignment.FindStringSubmatch(stmt); m != nil {
+			r.assign(m[1], m[2], m[3], unquote(m[4]))
+			continue
+		}
+		/* addtask, deltask, EXPORT_FUNCTIONS, addhandler and friends do
+		 * not affect the metadata we care about */
+	}
+	return scanner.Err()
+}
+
+func (r *Recipe) directive(kind string, args string, dir string, bbpath []string, depth int) error {
+	switch kind {
+	case "inherit", "inherit_defer":
+		for _, c := range Fields(r.Expand(args)) {
+			/* conditional inherits, eg ${@bb.utils.contains(...)}, need
+			 * python to pick the class */
+			if Unexpanded(c) {
+				utils.Logger.Trace("Skipping inherit that cannot be expanded", utils.Logger.Args("file", r.File, "inherit", c))
+				continue
+			}
+			if !contains(r.Inherits, c) {
+				r.Inherits = append(r.Inherits, c)
+			}
+		}
+		return nil
+	case "include_all":
+		/* include_all includes the file from every BBPATH entry that has
+		 * it, and none having it is fine */
+		for _, inc := range Fields(r.Expand(args)) {
+			if Unexpanded(inc) || path.IsAbs(inc) {
+				continue
+			}
+			for _, p := range bbpath {
+				file := path.Join(p, inc)
+				if _, err := os.Stat(file); err != nil {
+					continue
+				}
+				f, err := os.Open(file)
+				if err != nil {
+					continue
+				}
+				r.Includes = append(r.Includes, file)
+				err = r.parse(f, path.Dir(file), bbpath, depth+1)
+				f.Close()
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, inc := range Fields(r.Expand(args)) {
+		file := ""
+		if !Unexpanded(inc) {
+			file = r.findInclude(inc, dir, bbpath)
+		}
+		if file == "" {
+			if kind == "require" {
+				return fmt.Errorf("could not find required file %s", inc)
+			}
+			utils.Logger.Trace("Include not found", utils.Logger.Args("file", r.File, "include", inc))
+			continue
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			if kind == "require" {
+				return err
+			}
+			continue
+		}
+		r.Includes = append(r.Includes, file)
+		err = r.parse(f, path.Dir(file), bbpath, depth+1)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Recipe) findInclude(inc string, dir string, bbpath []string) string {
+	if path.IsAbs(inc) {
+		if _, err := os.Stat(inc); err == nil {
+			return inc
+		}
+		return ""
+	}
+	candidates := []string{}
+	if dir != "" {
+		candidates = append(candidates, path.Join(dir, inc))
+	}
+	for _, p := range bbpath {
+		candidates = append(candidates, path.Join(p, inc))
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c
+		}
+	}
+	return ""
+}
+
+func (r *Recipe) assign(name string, flag string, op string, value string) {
+	/* old style VAR_append is the same as VAR:append */
+	for _, o := range []string{"append", "prepend", "remove"} {
+		if strings.HasSuffix(name, "_"+o) {
+			name = strings.TrimSuffix(name, "_"+o) + ":" + o
+		}
+	}
+	if flag != "" {
+		name = name + flag
+	}
+	switch {
+	case strings.HasSuffix(name, ":append"):
+		base := strings.TrimSuffix(name, ":append")
+		r.appends[base] = append(r.appends[base], value)
+		return
+	case strings.HasSuffix(name, ":prepend"):
+		base := strings.TrimSuffix(name, ":prepend")
+		r.prepends[base] = append(r.prepends[base], value)
+		return
+	case strings.HasSuffix(name, ":remove"):
+		base := strings.TrimSuffix(name, ":remove")
+		r.removes[base] = append(r.removes[base], value)
+		return
+	}
+	cur, set := r.vars[name]
+	switch op {
+	case "=":
+		r.vars[name] = value
+	case ":=":
+		r.vars[name] = r.Expand(value)
+	case "?=":
+		if !set {
+			r.vars[name] = value
+		}
+	case "??=":
+		r.weak[name] = value
+	case "+=":
+		r.vars[name] = join(r.value(name, cur, set), value, " ")
+	case "=+":
+		r.vars[name] = join(value, r.value(name, cur, set), " ")
+	case ".=":
+		r.vars[name] = r.value(name, cur, set) + value
+	case "=.":
+		r.vars[name] = value + r.value(name, cur, set)
+	}
+}
+
+/* value returns the current value, falling back to a weak default */
+func (r *Recipe) value(name string, cur string, set bool) string {
+	if set {
+		return cur
+	}
+	return r.weak[name]
+}
+
+/* Raw returns the unexpanded value of a variable after applying
+ * :append, :prepend and :remove */
+func (r *Recipe) Raw(name string) (string, bool) {
+	v, ok := r.vars[name]
+	if !ok {
+		v, ok = r.weak[name]
+	}
+	for _, p := range r.prepends[name] {
+		v = p + v
+		ok = true
+	}
+	for _, a := range r.appends[name] {
+		v = v + a
+		ok = true
+	}
+	if rm, found := r.removes[name]; found {
+		remove := make(map[string]bool)
+		for _, x := range rm {
+			for _, f := range strings.Fields(r.Expand(x)) {
+				remove[f] = true
+			}
+		}
+		var keep []string
+		for _, f := range strings.Fields(v) {
+			if !remove[r.Expand(f)] {
+				keep = append(keep, f)
+			}
+		}
+		v = strings.Join(keep, " ")
+	}
+	return v, ok
+}
+
+/* Get returns the expanded value of a variable */
+func (r *Recipe) Get(name string) string {
+	v, _ := r.Raw(name)
+	return r.Expand(v)
+}
+
+/* GetFlag returns the expanded value of a variable flag, eg SRC_URI[sha256sum] */
+func (r *Recipe) GetFlag(name string, flag string) string {
+	return r.Get(name + "[" + flag + "]")
+}
+
+/* Has reports if the variable was set at all */
+func (r *Recipe) Has(name string) bool {
+	_, ok := r.Raw(name)
+	return ok
+}
+
+/* Variables returns every variable with its expanded value */
+func (r *Recipe) Variables() map[string]string {
+	vars := make(map[string]string)
+	for _, m := range []map[string]string{r.weak, r.vars} {
+		for k := range m {
+			vars[k] = r.Get(k)
+		}
+	}
+	for _, m := range []map[string][]string{r.appends, r.prepends} {
+		for k := range m {
+			vars[k] = r.Get(k)
+		}
+	}
+	return vars
+}
+
+/* Set overrides a variable, for example to seed LAYERDIR */
+func (r *Recipe) Set(name string, value string) {
+	r.vars[name] = value
+}
+
+/* Expand replaces ${VAR} references. Python expressions and unknown
+ * variables are left as they are */
+func (r *Recipe) Expand(s string) string {
+	return r.expand(s, 0)
+}
+
+func (r *Recipe) expand(s string, depth int) string {
+	if depth > maxdepth || !strings.Contains(s, "${") {
+		return s
+	}
+	return variable.ReplaceAllStringFunc(s, func(m string) string {
+		sm := variable.FindStringSubmatch(m)
+		v, ok := r.Raw(sm[1] + sm[2])
+		if !ok {
+			return m
+		}
+		return r.expand(v, depth+1)
+	})
+}
+
+/* Fields splits a value on whitespace like strings.Fields, but keeps a
+ * ${...} reference whole, so a python expression with spaces in it is one
+ * field */
+func Fields(s string) (fields []string) {
+	var cur strings.Builder
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			cur.WriteString("${")
+			i++
+			continue
+		case c == '}' && depth > 0:
+			depth--
+		case depth == 0 && (c == ' ' || c == '\t' || c == '\n' || c == '\r'):
+			if cur.Len() > 0 {
+				fields = append(fields, cur.String())
+				cur.Reset()
+			}
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	if cur.Len() > 0 {
+		fields = append(fields, cur.String())
+	}
+	return fields
+}
+
+/* Unexpanded reports if a value still holds a ${...} reference after
+ * expansion, a python expression or an unknown variable */
+func Unexpanded(s string) bool {
+	return strings.Contains(s, "${")
+}
+
+func unquote(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+func join(a string, b string, sep string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return a + sep + b
+}
+
+func contains(list []string, v string) bool {
+	for _, l := range list {
+		if l == v {
+			return true
+		}
+	}
+	return false
+}
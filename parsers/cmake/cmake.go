@@ -0,0 +1,363 @@
+package cmake
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/utils"
+)
+
+/* Package is a single dependency discovered in a CMakeLists.txt */
+type Package struct {
+	Name       string
+	Version    string
+	Components []string
+	Command    string
+	Type       string
+}
+
+/* Names returns the CMake config package names this dependency resolves to.
+ * find_package(Qt5 COMPONENTS Core Quick) yields Qt5Core and Qt5Quick */
+func (p Package) Names() (names []string) {
+	if len(p.Components) == 0 {
+		return []string{p.Name}
+	}
+	for _, c := range p.Components {
+		names = append(names, p.Name+c)
+	}
+	return names
+}
+
+func (p Package) Required() bool {
+	return p.Type == "REQUIRED"
+}
+
+type command struct {
+	Name string
+	Args []string
+}
+
+type CMakeParser struct {
+	ready     bool
+	Variables map[string]string
+}
+
+var (
+	variable    = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)\}`)
+	pkgspec     = regexp.MustCompile(`^([^<>=]+)`)
+	findOptions = map[string]bool{
+		"EXACT": true, "QUIET": true, "MODULE": true, "CONFIG": true, "NO_MODULE": true,
+		"NO_POLICY_SCOPE": true, "GLOBAL": true, "NO_DEFAULT_PATH": true,
+	}
+)
+
+func NewParser() *CMakeParser {
+	return &CMakeParser{
+		Variables: map[string]string{
+			"QT_MAJOR_VERSION": "5",
+			"KF_MAJOR_VERSION": "5",
+		},
+	}
+}
+
+func (k *CMakeParser) GetName() string {
+	return "CMake"
+}
+
+func (k *CMakeParser) Init() error {
+	utils.Logger.Trace("Initializing CMake Parser")
+	k.ready = true
+	return nil
+}
+
+func (k *CMakeParser) Ready() bool {
+	return k.ready
+}
+
+func (k *CMakeParser) Parse(data io.Reader) (metadata map[string]interface{}, err error) {
+	metadata = make(map[string]interface{})
+	pkgs, err := k.ParsePackages(data)
+	if err != nil {
+		utils.Logger.Error("Failed to parse CMakeLists", utils.Logger.Args("error", err))
+		return metadata, err
+	}
+	metadata["packages"] = pkgs
+	return metadata, nil
+}
+
+/* ParsePackages returns the find_package, ecm_find_qmlmodule and
+ * pkg_check_modules calls found in a CMakeLists.txt, merged by name */
+func (k *CMakeParser) ParsePackages(data io.Reader) (pkgs []Package, err error) {
+	raw, err := io.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string)
+	for n, v := range k.Variables {
+		vars[n] = v
+	}
+	index := make(map[string]int)
+	add := func(p Package) {
+		key := p.Command + ":" + p.Name
+		if i, ok := index[key]; ok {
+			pkgs[i].Components = appendUnique(pkgs[i].Components, p.Components...)
+			if p.Type == "REQUIRED" || pkgs[i].Type == "" {
+				pkgs[i].Type = p.Type
+			}
+			if pkgs[i].Version == "" {
+				pkgs[i].Version = p.Version
+			}
+			return
+		}
+		index[key] = len(pkgs)
+		pkgs = append(pkgs, p)
+	}
+
+	for _, cmd := range tokenize(string(raw)) {
+		args := make([]string, 0, len(cmd.Args))
+		for _, a := range cmd.Args {
+			args = append(args, expand(a, vars))
+		}
+		switch cmd.Name {
+		case "set":
+			if len(args) >= 2 {
+				vars[args[0]] = args[1]
+			}
+		case "find_package":
+			if p, ok := parseFindPackage(args); ok {
+				add(p)
+			}
+		case "ecm_find_qmlmodule":
+			if len(args) == 0 {
+				continue
+			}
+			p := Package{Name: args[0], Command: cmd.Name}
+			for _, a := range args[1:] {
+				switch a {
+				case "REQUIRED", "OPTIONAL", "RECOMMENDED", "RUNTIME":
+					p.Type = a
+				default:
+					if p.Version == "" {
+						p.Version = a
+					}
+				}
+			}
+			add(p)
+		case "pkg_check_modules", "pkg_search_module":
+			if len(args) < 2 {
+				continue
+			}
+			/* REQUIRED applies to every module, wherever it is given */
+			typ := ""
+			for _, a := range args[1:] {
+				if a == "REQUIRED" {
+					typ = a
+				}
+			}
+			for _, a := range args[1:] {
+				switch a {
+				case "REQUIRED", "QUIET", "NO_CMAKE_PATH", "NO_CMAKE_ENVIRONMENT_PATH", "IMPORTED_TARGET", "GLOBAL":
+				default:
+					m := pkgspec.FindStringSubmatch(a)
+					if m == nil {
+						continue
+					}
+					add(Package{
+						Name:    strings.TrimSpace(m[1]),
+						Version: strings.TrimLeft(strings.TrimPrefix(a, m[1]), "<>="),
+						Command: "pkg_check_modules",
+						Type:    typ,
+					})
+				}
+			}
+		case "set_package_properties":
+			if len(args) == 0 {
+				continue
+			}
+			for i := 1; i < len(args)-1; i++ {
+				if args[i] == "TYPE" {
+					for j := range pkgs {
+						if pkgs[j].Name == args[0] && pkgs[j].Command == "find_package" {
+							pkgs[j].Type = args[i+1]
+						}
+					}
+				}
+			}
+		}
+	}
+	return pkgs, nil
+}
+
+func parseFindPackage(args []string) (p Package, ok bool) {
+	if len(args) == 0 {
+		return p, false
+	}
+	p = Package{Name: args[0], Command: "find_package"}
+	incomponents := false
+	for i, a := range args[1:] {
+		switch {
+		case a == "REQUIRED":
+			p.Type = a
+			incomponents = true
+		case a == "COMPONENTS":
+			incomponents = true
+		case a == "OPTIONAL_COMPONENTS":
+			/* optional components are not build dependencies */
+			return p, true
+		case findOptions[a]:
+		case a == "NAMES" || a == "CONFIGS" || a == "HINTS" || a == "PATHS" || a == "PATH_SUFFIXES":
+			return p, true
+		case i == 0 && len(a) > 0 && a[0] >= '0' && a[0] <= '9':
+			p.Version = a
+		case incomponents:
+			p.Components = appendUnique(p.Components, a)
+		}
+	}
+	return p, true
+}
+
+func expand(s string, vars map[string]string) string {
+	return variable.ReplaceAllStringFunc(s, func(m string) string {
+		if v, ok := vars[variable.FindStringSubmatch(m)[1]]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, l := range list {
+			if l == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+/* tokenize splits CMake source into commands and their arguments. It
+ * understands comments, quoted arguments and nested parentheses, which is
+ * all we need to pick out dependency declarations */
+func tokenize(src string) (cmds []command) {
+	i := 0
+	n := len(src)
+	for i < n {
+		c := src[i]
+		switch {
+		case c == '#':
+			i = skipComment(src, i)
+		case isIdentStart(c):
+			start := i
+			for i < n && isIdent(src[i]) {
+				i++
+			}
+			name := strings.ToLower(src[start:i])
+			j := i
+			for j < n && (src[j] == ' ' || src[j] == '\t') {
+				j++
+			}
+			if j < n && src[j] == '(' {
+				var args []string
+				args, i = parseArgs(src, j+1)
+				cmds = append(cmds, command{Name: name, Args: args})
+			}
+		case c == '"':
+			_, i = parseQuoted(src, i+1)
+		default:
+			i++
+		}
+	}
+	return cmds
+}
+
+func parseArgs(src string, i int) (args []string, end int) {
+	n := len(src)
+	depth := 0
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			args = append(args, cur.String())
+			cur.Reset()
+		}
+	}
+	for i < n {
+		c := src[i]
+		switch {
+		case c == '#':
+			flush()
+			i = skipComment(src, i)
+			continue
+		case c == '"':
+			var q string
+			q, i = parseQuoted(src, i+1)
+			cur.WriteString(q)
+			if cur.Len() == 0 {
+				args = append(args, "")
+			}
+			continue
+		case c == '(':
+			depth++
+			cur.WriteByte(c)
+		case c == ')':
+			if depth == 0 {
+				flush()
+				return args, i + 1
+			}
+			depth--
+			cur.WriteByte(c)
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush()
+		default:
+			cur.WriteByte(c)
+		}
+		i++
+	}
+	flush()
+	return args, n
+}
+
+func parseQuoted(src string, i int) (string, int) {
+	var b strings.Builder
+	for i < len(src) {
+		c := src[i]
+		if c == '\\' && i+1 < len(src) {
+			b.WriteByte(src[i+1])
+			i += 2
+			continue
+		}
+		if c == '"' {
+			return b.String(), i + 1
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return b.String(), i
+}
+
+func skipComment(src string, i int) int {
+	if strings.HasPrefix(src[i:], "#[[") {
+		if end := strings.Index(src[i:], "]]"); end >= 0 {
+			return i + end + 2
+		}
+		return len(src)
+	}
+	if end := strings.IndexByte(src[i:], '\n'); end >= 0 {
+		return i + end + 1
+	}
+	return len(src)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdent(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
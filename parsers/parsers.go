@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	"github.com/Fishwaldo/go-yocto/parsers/appstream"
+	"github.com/Fishwaldo/go-yocto/parsers/bitbake"
+	"github.com/Fishwaldo/go-yocto/parsers/cmake"
 	"github.com/Fishwaldo/go-yocto/utils"
 )
 
@@ -23,6 +25,10 @@ func init() {
 	parsers = make(map[string]Parsers, 0)
 	as := appstream.NewParser()
 	parsers[strings.ToLower(as.GetName())] = as
+	cm := cmake.NewParser()
+	parsers[strings.ToLower(cm.GetName())] = cm
+	bb := bitbake.NewParser()
+	parsers[strings.ToLower(bb.GetName())] = bb
 }
 
 func InitParsers() (err error) {
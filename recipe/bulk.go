@@ -0,0 +1,267 @@
+package recipe
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/Fishwaldo/go-yocto/backends"
+	"github.com/Fishwaldo/go-yocto/source"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/pterm/pterm"
+	"github.com/spf13/viper"
+)
+
+const (
+	BulkCreated  = "created"
+	BulkExisting = "skipped"
+	BulkFailed   = "failed"
+)
+
+/* BulkResult is the outcome for a single recipe of a bulk create */
+type BulkResult struct {
+	Identifier string         `json:"identifier" yaml:"identifier"`
+	Version    string         `json:"version" yaml:"version"`
+	Status     string         `json:"status" yaml:"status"`
+	Reason     string         `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Overrides  []string       `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+	Recipe     *source.Record `json:"recipe,omitempty" yaml:"recipe,omitempty"`
+}
+
+type bulkItem struct {
+	identifier string
+	source     *source.RecipeSource
+	result     *BulkResult
+}
+
+func init() {
+	viper.SetDefault("recipe.jobs", 4)
+}
+
+/* ReadManifest reads identifiers or repopath globs, one per line. Blank
+ * lines and # comments are ignored */
+func ReadManifest(file string) (entries []string, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line != "" {
+			entries = append(entries, line)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+/* IsPattern reports if a name should be expanded as a glob */
+func IsPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+/* CreateRecipes creates every recipe matching the given identifiers or
+ * repopath globs. The layers are scanned once, the recipes are resolved
+ * concurrently and then written in dependency order, so recipes in the
+ * same batch may depend on each other */
+func CreateRecipes(be string, patterns []string) (results []*BulkResult, err error) {
+	utils.Logger.Trace("Creating Recipes", utils.Logger.Args("backend", be, "patterns", patterns))
+	b, ok := backends.Backends[be]
+	if !ok {
+		utils.Logger.Error("Backend not found", utils.Logger.Args("backend", be))
+		return nil, errors.New("backend not found")
+	}
+	if !b.Ready() {
+		utils.Logger.Error("Backend not ready", utils.Logger.Args("backend", be))
+		return nil, errors.New("backend not ready")
+	}
+	if err := ScanLayers(); err != nil {
+		utils.Logger.Error("Failed to scan layers", utils.Logger.Args("error", err))
+		return nil, err
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, p := range patterns {
+		matches := []string{p}
+		if IsPattern(p) {
+			if matches, err = b.ListRecipes(p); err != nil {
+				utils.Logger.Error("Invalid pattern", utils.Logger.Args("pattern", p, "error", err))
+				return nil, err
+			}
+			if len(matches) == 0 {
+				utils.Logger.Warn("Pattern matched no recipes", utils.Logger.Args("pattern", p))
+			}
+		}
+		for _, id := range matches {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	items := make(map[string]*bulkItem)
+	var pending []*bulkItem
+	for _, id := range ids {
+		item := &bulkItem{identifier: id, result: &BulkResult{Identifier: id}}
+		results = append(results, item.result)
+		if e, ok := existing.Lookup(id); ok {
+			item.result.Status = BulkExisting
+			item.result.Reason = "exists at " + e.Preferred().Path
+			continue
+		}
+		pending = append(pending, item)
+	}
+
+	/* an interrupt stops the run between recipes, so every recipe that
+	 * was written is complete */
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	interrupted := false
+
+	/* resolve everything against the backend concurrently, where prompts
+	 * and spinners from the workers would get in each others way */
+	opts := source.Options{Interactive: false, Quiet: true}
+	jobs := viper.GetInt("recipe.jobs")
+	if jobs < 1 {
+		jobs = 1
+	}
+	p, _ := pterm.DefaultProgressbar.WithTotal(len(pending)).WithTitle("Resolving Recipes...").Start()
+	queue := make(chan *bulkItem)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range queue {
+				s, err := getRecipe(b, item.identifier, opts)
+				mu.Lock()
+				if err != nil {
+					item.result.Status = BulkFailed
+					item.result.Reason = err.Error()
+				} else {
+					item.source = s
+					item.result.Version = s.Version
+					item.result.Overrides = s.Overrides
+					items[s.Identifier] = item
+				}
+				p.Increment()
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, item := range pending {
+		select {
+		case queue <- item:
+		case <-interrupt:
+			interrupted = true
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	/* dependancies may be satisfied by other recipes in the batch */
+	for _, item := range items {
+		var unresolved []string
+		for i, dep := range item.source.Depends {
+			if r, ok := resolveDepend(dep); ok {
+				item.source.Depends[i] = r
+			} else if _, ok := items[dep]; !ok {
+				unresolved = append(unresolved, dep)
+			}
+		}
+		if len(unresolved) > 0 {
+			item.result.Status = BulkFailed
+			item.result.Reason = "unresolved dependancies: " + strings.Join(unresolved, ", ")
+		}
+	}
+
+	for _, id := range bulkOrder(items) {
+		item := items[id]
+		if item.result.Status != "" {
+			continue
+		}
+		select {
+		case <-interrupt:
+			interrupted = true
+		default:
+		}
+		if interrupted {
+			item.result.Status = BulkFailed
+			item.result.Reason = "interrupted"
+			continue
+		}
+		if err := writeRecipeFiles(item.source); err != nil {
+			item.result.Status = BulkFailed
+			item.result.Reason = err.Error()
+			continue
+		}
+		item.result.Status = BulkCreated
+		r := item.source.Record()
+		item.result.Recipe = &r
+	}
+	for _, r := range results {
+		if r.Status == "" {
+			r.Status = BulkFailed
+			r.Reason = "interrupted"
+		}
+	}
+	if interrupted {
+		return results, errors.New("interrupted")
+	}
+	return results, nil
+}
+
+/* bulkOrder orders the batch so dependancies come first. A recipe whose
+ * batch dependancy failed, or that is part of a cycle, is marked failed */
+func bulkOrder(items map[string]*bulkItem) (order []string) {
+	state := make(map[string]int)
+	var visit func(id string) bool
+	visit = func(id string) bool {
+		item := items[id]
+		switch state[id] {
+		case 1:
+			item.result.Status = BulkFailed
+			item.result.Reason = "dependency cycle"
+			return false
+		case 2:
+			return item.result.Status == ""
+		}
+		state[id] = 1
+		for _, dep := range item.source.Depends {
+			if _, inbatch := items[dep]; !inbatch {
+				continue
+			}
+			if !visit(dep) && item.result.Status == "" {
+				item.result.Status = BulkFailed
+				item.result.Reason = "dependancy " + dep + " failed"
+			}
+		}
+		state[id] = 2
+		order = append(order, id)
+		return item.result.Status == ""
+	}
+	var ids []string
+	for id := range items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		visit(id)
+	}
+	return order
+}
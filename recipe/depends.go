@@ -0,0 +1,134 @@
+package recipe
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/backends"
+	"github.com/Fishwaldo/go-yocto/source"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/pterm/pterm"
+)
+
+/* planNode is a recipe that has to be created, and the missing recipes it
+ * needs created first */
+type planNode struct {
+	Identifier string
+	Source     *source.RecipeSource
+	Missing    []string
+}
+
+/* recipePlan is the set of recipes to create, in dependency order */
+type recipePlan struct {
+	Order      []*planNode
+	Unresolved map[string][]string
+}
+
+/* planRecipes walks the dependency graph from identifier. Dependencies that
+ * are not in the layer index are looked up in the backend and planned as
+ * well. The returned order is bottom-up, so every recipe comes after the
+ * recipes it depends on */
+func planRecipes(b backends.Backend, identifier string) (*recipePlan, error) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	plan := &recipePlan{Unresolved: make(map[string][]string)}
+	state := make(map[string]int)
+	missing := make(map[string]bool)
+
+	var visit func(id string, stack []string) (bool, error)
+	visit = func(id string, stack []string) (bool, error) {
+		switch state[id] {
+		case visiting:
+			return false, fmt.Errorf("dependency cycle: %s", strings.Join(append(stack, id), " -> "))
+		case done:
+			return !missing[id], nil
+		}
+		state[id] = visiting
+		defer func() { state[id] = done }()
+
+		s, err := getRecipe(b, id, singleOptions())
+		if err != nil {
+			utils.Logger.Trace("Dependancy not available from backend", utils.Logger.Args("backend", b.GetName(), "identifier", id, "error", err))
+			missing[id] = true
+			return false, nil
+		}
+		node := &planNode{Identifier: s.Identifier, Source: s}
+		for i, dep := range s.Depends {
+			if r, ok := resolveDepend(dep); ok {
+				s.Depends[i] = r
+				continue
+			}
+			found, err := visit(dep, append(stack, id))
+			if err != nil {
+				return false, err
+			}
+			if !found {
+				plan.Unresolved[id] = append(plan.Unresolved[id], dep)
+				continue
+			}
+			node.Missing = append(node.Missing, dep)
+		}
+		plan.Order = append(plan.Order, node)
+		return true, nil
+	}
+
+	found, err := visit(identifier, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("recipe not found in backend")
+	}
+	return plan, nil
+}
+
+func (p *recipePlan) show() {
+	td := pterm.TableData{{"#", "Recipe", "Version", "Section", "Needs"}}
+	for i, n := range p.Order {
+		td = append(td, []string{strconv.Itoa(i + 1), n.Identifier, n.Source.Version, n.Source.Section, strings.Join(n.Missing, " ")})
+	}
+	pterm.DefaultSection.Println("Recipes to create")
+	pterm.DefaultTable.WithHasHeader().WithData(td).Render()
+	if len(p.Unresolved) > 0 {
+		var ids []string
+		for id := range p.Unresolved {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			pterm.Warning.Println("Unresolved dependancies for " + id + ": " + strings.Join(p.Unresolved[id], ", "))
+		}
+	}
+}
+
+/* createWithDepends creates identifier along with every missing dependency
+ * the backend can provide, bottom-up */
+func createWithDepends(b backends.Backend, identifier string) (created []*source.RecipeSource, err error) {
+	if e, ok := existing.Lookup(identifier); ok {
+		utils.Logger.Warn("Recipe already exists", utils.Logger.Args("recipe", identifier, "existing", e.Identifier, "location", e.Preferred().Path))
+		return nil, errors.New("recipe already exists")
+	}
+	plan, err := planRecipes(b, identifier)
+	if err != nil {
+		utils.Logger.Error("Failed to plan recipes", utils.Logger.Args("recipe", identifier, "error", err))
+		return nil, err
+	}
+	plan.show()
+	if len(plan.Unresolved) > 0 {
+		return nil, errors.New("recipe dependancy not found")
+	}
+	for _, n := range plan.Order {
+		utils.Logger.Info("Creating Recipe", utils.Logger.Args("recipe", n.Identifier, "version", n.Source.Version))
+		if err := writeRecipeFiles(n.Source); err != nil {
+			utils.Logger.Error("Failed to write Recipe Files", utils.Logger.Args("recipe", n.Identifier, "error", err))
+			return created, err
+		}
+		created = append(created, n.Source)
+	}
+	return created, nil
+}
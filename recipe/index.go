@@ -0,0 +1,424 @@
+package recipe
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/layer"
+	"github.com/Fishwaldo/go-yocto/parsers/bitbake"
+	"github.com/Fishwaldo/go-yocto/source"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/spf13/viper"
+)
+
+/* RecipeVersion is a single .bb file for a recipe */
+type RecipeVersion struct {
+	Version  string
+	Path     string
+	Layer    string
+	Priority int
+	Appends  []string
+	Source   *source.RecipeSource
+	Recipe   *bitbake.Recipe
+}
+
+/* RecipeEntry collects every version of a recipe found across the layers */
+type RecipeEntry struct {
+	Identifier string
+	Versions   []*RecipeVersion
+	Provides   []string
+	Variants   []string
+}
+
+/* RecipeIndex is the view of existing recipes across all scanned layers */
+type RecipeIndex struct {
+	Recipes map[string]*RecipeEntry
+	aliases map[string][]string
+	appends []layerFile
+	bbpath  []string
+}
+
+type layerFile struct {
+	Path     string
+	Layer    string
+	Priority int
+}
+
+var existing *RecipeIndex = NewRecipeIndex()
+
+func NewRecipeIndex() *RecipeIndex {
+	return &RecipeIndex{
+		Recipes: make(map[string]*RecipeEntry),
+		aliases: make(map[string][]string),
+	}
+}
+
+/* ExistingRecipes returns the index built by the last ScanLayers */
+func ExistingRecipes() *RecipeIndex {
+	return existing
+}
+
+/* Preferred returns the version BitBake would pick: the highest layer
+ * priority first, then the highest version */
+func (e *RecipeEntry) Preferred() *RecipeVersion {
+	if len(e.Versions) == 0 {
+		return nil
+	}
+	return e.Versions[0]
+}
+
+/* LayerVersion returns the newest version of the recipe found under
+ * layerdir, or nil if the layer does not carry the recipe */
+func (e *RecipeEntry) LayerVersion(layerdir string) (cur *RecipeVersion) {
+	layerdir, err := filepath.Abs(layerdir)
+	if err != nil {
+		return nil
+	}
+	for _, v := range e.Versions {
+		if abs, err := filepath.Abs(v.Path); err == nil && strings.HasPrefix(abs, layerdir+"/") {
+			if cur == nil || vercmp(v.Version, cur.Version) > 0 {
+				cur = v
+			}
+		}
+	}
+	return cur
+}
+
+/* Layers returns the layers carrying each version of the recipe */
+func (e *RecipeEntry) Layers() map[string][]string {
+	layers := make(map[string][]string)
+	for _, v := range e.Versions {
+		layers[v.Version] = append(layers[v.Version], v.Layer)
+	}
+	return layers
+}
+
+/* trackedRecipes returns the recipes of the layer we manage */
+func trackedRecipes() (entries []*RecipeEntry) {
+	for _, id := range existing.Identifiers() {
+		e := existing.Recipes[id]
+		if e.LayerVersion(viper.GetString("yocto.layerdirectory")) != nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+/* Lookup finds a recipe by name. The name may be the recipe itself, a
+ * native or nativesdk variant from BBCLASSEXTEND, or something it PROVIDES */
+func (i *RecipeIndex) Lookup(name string) (*RecipeEntry, bool) {
+	if e, ok := i.Recipes[name]; ok {
+		return e, true
+	}
+	if ids, ok := i.aliases[name]; ok && len(ids) > 0 {
+		return i.Recipes[ids[0]], true
+	}
+	return nil, false
+}
+
+/* Providers returns every recipe that provides name */
+func (i *RecipeIndex) Providers(name string) (entries []*RecipeEntry) {
+	if e, ok := i.Recipes[name]; ok {
+		entries = append(entries, e)
+	}
+	for _, id := range i.aliases[name] {
+		if id != name {
+			entries = append(entries, i.Recipes[id])
+		}
+	}
+	return entries
+}
+
+/* Identifiers returns the sorted list of recipe identifiers */
+func (i *RecipeIndex) Identifiers() (ids []string) {
+	for id := range i.Recipes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (i *RecipeIndex) addAlias(alias string, id string) {
+	for _, a := range i.aliases[alias] {
+		if a == id {
+			return
+		}
+	}
+	i.aliases[alias] = append(i.aliases[alias], id)
+}
+
+/* addRecipe parses a .bb file and records it under its identifier */
+func (i *RecipeIndex) addRecipe(f layerFile) error {
+	r, err := bitbake.ParseFile(f.Path, i.bbpath)
+	if err != nil {
+		return err
+	}
+	identifier, _ := bitbake.SplitFileName(path.Base(f.Path))
+	v := &RecipeVersion{
+		Path:     f.Path,
+		Layer:    f.Layer,
+		Priority: f.Priority,
+		Recipe:   r,
+	}
+	e, ok := i.Recipes[identifier]
+	if !ok {
+		e = &RecipeEntry{Identifier: identifier}
+		i.Recipes[identifier] = e
+	}
+	e.Versions = append(e.Versions, v)
+	return nil
+}
+
+/* finalize attaches bbappends, fills in the recipe sources and builds the
+ * PROVIDES and BBCLASSEXTEND aliases */
+func (i *RecipeIndex) finalize() {
+	for _, a := range i.appends {
+		matched := false
+		for _, e := range i.Recipes {
+			for _, v := range e.Versions {
+				if appendMatches(path.Base(a.Path), path.Base(v.Path)) {
+					v.Appends = append(v.Appends, a.Path)
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			utils.Logger.Warn("No recipe for bbappend", utils.Logger.Args("file", a.Path))
+		}
+	}
+	for id, e := range i.Recipes {
+		for _, v := range e.Versions {
+			for _, a := range v.Appends {
+				if err := v.Recipe.ParseInto(a, i.bbpath); err != nil {
+					utils.Logger.Error("Failed to parse bbappend", utils.Logger.Args("file", a, "error", err))
+				}
+			}
+			v.Source = recipeSource(id, v)
+			v.Version = v.Source.Version
+		}
+		sort.SliceStable(e.Versions, func(a, b int) bool {
+			if e.Versions[a].Priority != e.Versions[b].Priority {
+				return e.Versions[a].Priority > e.Versions[b].Priority
+			}
+			return vercmp(e.Versions[a].Version, e.Versions[b].Version) > 0
+		})
+		e.Provides = nil
+		e.Variants = nil
+		for _, v := range e.Versions {
+			for _, p := range strings.Fields(v.Recipe.Get("PROVIDES")) {
+				if !contains(e.Provides, p) {
+					e.Provides = append(e.Provides, p)
+				}
+				i.addAlias(p, id)
+			}
+			if name := v.Recipe.Get("PN"); name != id {
+				i.addAlias(name, id)
+			}
+			for _, c := range strings.Fields(v.Recipe.Get("BBCLASSEXTEND")) {
+				var variant string
+				switch {
+				case c == "native":
+					variant = id + "-native"
+				case c == "nativesdk":
+					variant = "nativesdk-" + id
+				default:
+					continue
+				}
+				if !contains(e.Variants, variant) {
+					e.Variants = append(e.Variants, variant)
+				}
+				i.addAlias(variant, id)
+			}
+		}
+	}
+}
+
+func recipeSource(id string, v *RecipeVersion) *source.RecipeSource {
+	r := v.Recipe
+	return &source.RecipeSource{
+		Name:               r.Get("PN"),
+		Identifier:         id,
+		Description:        r.Get("DESCRIPTION"),
+		Summary:            r.Get("SUMMARY"),
+		Version:            r.Get("PV"),
+		Url:                r.Get("HOMEPAGE"),
+		Section:            recipeSection(v.Path),
+		BackendID:          "existing",
+		Inherits:           r.Inherits,
+		Depends:            strings.Fields(r.Get("DEPENDS")),
+		SrcURI:             r.Get("SRC_URI"),
+		SrcSHA256:          r.GetFlag("SRC_URI", "sha256sum"),
+		Licenses:           splitLicense(r.Get("LICENSE")),
+		Location:           v.Path,
+		UpstreamCheckURI:   r.Get("UPSTREAM_CHECK_URI"),
+		UpstreamCheckRegex: r.Get("UPSTREAM_CHECK_REGEX"),
+		BuildSystem:        buildSystem(r.Inherits),
+	}
+}
+
+/* buildSystem guesses the build system of a recipe from its classes */
+func buildSystem(inherits []string) string {
+	for _, i := range inherits {
+		switch {
+		case strings.HasPrefix(i, "cmake"):
+			return "cmake"
+		case i == "meson":
+			return "meson"
+		case i == "setuptools3" || strings.HasPrefix(i, "python_"):
+			return "python"
+		case i == "autotools" || i == "autotools-brokensep":
+			return "autotools"
+		}
+	}
+	return ""
+}
+
+/* appendMatches reports if a bbappend applies to a recipe file. A % in the
+ * bbappend version matches any trailing characters */
+func appendMatches(appendfile string, recipefile string) bool {
+	a := strings.TrimSuffix(appendfile, ".bbappend")
+	r := strings.TrimSuffix(recipefile, ".bb")
+	if i := strings.Index(a, "%"); i >= 0 {
+		return strings.HasPrefix(r, a[:i])
+	}
+	return a == r
+}
+
+/* scanLayerFiles adds the recipes and bbappends matched by the layers
+ * BBFILES patterns */
+func scanLayerFiles(index *RecipeIndex, l layer.Layer) {
+	for _, file := range l.Files() {
+		/* BBFILES globs can reach into an unfinished transaction */
+		if inStaging(file) {
+			continue
+		}
+		f := layerFile{Path: file, Layer: l.Path, Priority: l.Priority}
+		switch path.Ext(file) {
+		case ".bb":
+			if err := index.addRecipe(f); err != nil {
+				utils.Logger.Error("Failed to parse recipe file", utils.Logger.Args("error", err, "file", f.Path))
+			}
+		case ".bbappend":
+			index.appends = append(index.appends, f)
+		}
+	}
+}
+
+/* scanRecipes walks the recipes-* directories of a layer without a
+ * conf/layer.conf */
+func scanRecipes(index *RecipeIndex, layerdir string, priority int, dir string, level int) error {
+
+	fsrecipessections, err := os.ReadDir(dir)
+	if err != nil {
+		utils.Logger.Error("Failed to read directory", utils.Logger.Args("error", err))
+		return err
+	}
+
+	for _, file := range fsrecipessections {
+		if file.IsDir() {
+			if level == 0 {
+				ok, _ := filepath.Match("recipes-*", file.Name())
+				if !ok {
+					continue
+				}
+			}
+			if err := scanRecipes(index, layerdir, priority, path.Join(dir, file.Name()), level+1); err != nil {
+				utils.Logger.Error("Failed to scan directory", utils.Logger.Args("error", err))
+				continue
+			}
+		} else if file.Type().IsRegular() {
+			f := layerFile{Path: path.Join(dir, file.Name()), Layer: layerdir, Priority: priority}
+			switch strings.ToLower(path.Ext(file.Name())) {
+			case ".bb":
+				if err := index.addRecipe(f); err != nil {
+					utils.Logger.Error("Failed to parse recipe file", utils.Logger.Args("error", err, "file", f.Path))
+					continue
+				}
+			case ".bbappend":
+				index.appends = append(index.appends, f)
+			}
+		}
+	}
+	return nil
+}
+
+/* recipeSection returns the section of a recipe from the recipes-* directory
+ * it lives in, without the recipes- prefix */
+func recipeSection(fname string) string {
+	for dir := path.Dir(fname); dir != "/" && dir != "."; dir = path.Dir(dir) {
+		if strings.HasPrefix(path.Base(dir), "recipes-") {
+			return strings.TrimPrefix(path.Base(dir), "recipes-")
+		}
+	}
+	return ""
+}
+
+/* splitLicense turns a LICENSE expression into the individual licenses */
+func splitLicense(license string) (licenses []string) {
+	for _, l := range strings.FieldsFunc(license, func(r rune) bool {
+		return strings.ContainsRune("&|() \t", r)
+	}) {
+		licenses = append(licenses, l)
+	}
+	return licenses
+}
+
+/* vercmp compares two versions the way BitBake orders PV, comparing runs
+ * of digits numerically and everything else lexically */
+func vercmp(a string, b string) int {
+	for a != "" || b != "" {
+		var ca, cb string
+		ca, a = nextChunk(a)
+		cb, b = nextChunk(b)
+		na, erra := strconv.Atoi(ca)
+		nb, errb := strconv.Atoi(cb)
+		switch {
+		case erra == nil && errb == nil:
+			if na != nb {
+				if na < nb {
+					return -1
+				}
+				return 1
+			}
+		case ca != cb:
+			/* a numeric chunk sorts after a non-numeric one */
+			if erra == nil {
+				return 1
+			}
+			if errb == nil {
+				return -1
+			}
+			if ca < cb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func nextChunk(s string) (chunk string, rest string) {
+	s = strings.TrimLeft(s, ".-_+~")
+	if s == "" {
+		return "", ""
+	}
+	digit := s[0] >= '0' && s[0] <= '9'
+	i := 0
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9') == digit && !strings.ContainsRune(".-_+~", rune(s[i])) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func contains(list []string, v string) bool {
+	for _, l := range list {
+		if l == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package recipe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/backends"
+	"github.com/Fishwaldo/go-yocto/parsers/bitbake"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/spf13/viper"
+)
+
+const (
+	managedBegin = "# BEGIN go-yocto managed "
+	managedEnd   = "# END go-yocto managed "
+
+	RefreshRefreshed = "refreshed"
+	RefreshUnchanged = "unchanged"
+	RefreshFailed    = "failed"
+)
+
+/* RefreshResult is the outcome of refreshing a single recipe */
+type RefreshResult struct {
+	Identifier string   `json:"identifier" yaml:"identifier"`
+	Version    string   `json:"version" yaml:"version"`
+	Path       string   `json:"path,omitempty" yaml:"path,omitempty"`
+	Status     string   `json:"status" yaml:"status"`
+	Reason     string   `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Conflicts  []string `json:"conflicts,omitempty" yaml:"conflicts,omitempty"`
+	Overrides  []string `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+}
+
+/* an assignment, captures the variable with its overrides, the flag and
+ * the operator */
+var assignment = regexp.MustCompile(`^\s*(?:export\s+)?([A-Za-z0-9_\-\${}/.+:]+)(\[[^\]]*\])?\s*(\?\?=|\?=|:=|\+=|=\+|\.=|=\.|=)`)
+
+/* managedBlock is the content between a pair of markers */
+type managedBlock struct {
+	Name  string
+	Start int
+	End   int
+}
+
+/* managedBlocks finds the marker delimited blocks in a file. Start and End
+ * are the lines of the markers */
+func managedBlocks(lines []string) (blocks []managedBlock, err error) {
+	var open *managedBlock
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, managedBegin):
+			if open != nil {
+				return nil, fmt.Errorf("line %d: managed block %s is not closed", i+1, open.Name)
+			}
+			open = &managedBlock{Name: strings.TrimSpace(strings.TrimPrefix(line, managedBegin)), Start: i}
+		case strings.HasPrefix(line, managedEnd):
+			name := strings.TrimSpace(strings.TrimPrefix(line, managedEnd))
+			if open == nil || open.Name != name {
+				return nil, fmt.Errorf("line %d: end of managed block %s without a start", i+1, name)
+			}
+			open.End = i
+			blocks = append(blocks, *open)
+			open = nil
+		}
+	}
+	if open != nil {
+		return nil, fmt.Errorf("managed block %s is not closed", open.Name)
+	}
+	return blocks, nil
+}
+
+/* replaceManaged replaces the managed blocks of current with those of
+ * rendered, keeping everything outside the markers. It returns the
+ * variables set in a managed block that are also assigned by hand */
+func replaceManaged(current string, rendered string) (result string, conflicts []string, err error) {
+	cur := strings.Split(current, "\n")
+	curblocks, err := managedBlocks(cur)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(curblocks) == 0 {
+		return "", nil, errors.New("no managed blocks")
+	}
+	ren := strings.Split(rendered, "\n")
+	renblocks, err := managedBlocks(ren)
+	if err != nil {
+		return "", nil, err
+	}
+	content := make(map[string][]string)
+	managed := make(map[string]bool)
+	for _, b := range renblocks {
+		content[b.Name] = ren[b.Start+1 : b.End]
+		for _, line := range content[b.Name] {
+			if m := assignment.FindStringSubmatch(line); m != nil && m[2] == "" {
+				managed[m[1]] = true
+			}
+		}
+	}
+
+	var out []string
+	last := 0
+	for _, b := range curblocks {
+		out = append(out, cur[last:b.Start+1]...)
+		if c, ok := content[b.Name]; ok {
+			out = append(out, c...)
+		} else {
+			utils.Logger.Warn("Managed block is no longer generated, keeping it", utils.Logger.Args("block", b.Name))
+			out = append(out, cur[b.Start+1:b.End]...)
+		}
+		last = b.End
+	}
+	out = append(out, cur[last:]...)
+
+	/* a plain assignment by hand replaces what we generate */
+	inblock := make(map[int]bool)
+	for _, b := range curblocks {
+		for i := b.Start; i <= b.End; i++ {
+			inblock[i] = true
+		}
+	}
+	seen := make(map[string]bool)
+	for i, line := range cur {
+		if inblock[i] {
+			continue
+		}
+		/* appends, prepends and overrides add to what we generate */
+		m := assignment.FindStringSubmatch(line)
+		if m == nil || m[2] != "" || !managed[m[1]] || seen[m[1]] {
+			continue
+		}
+		switch m[3] {
+		case "=", ":=", "?=", "??=":
+			seen[m[1]] = true
+			conflicts = append(conflicts, m[1])
+		}
+	}
+	return strings.Join(out, "\n"), conflicts, nil
+}
+
+/* RefreshRecipes regenerates the managed blocks of recipes in the layer
+ * at their current version. With no identifiers every recipe the layer
+ * tracks and the backend knows about is refreshed */
+func RefreshRecipes(be string, identifiers []string) (results []*RefreshResult, err error) {
+	utils.Logger.Trace("Refreshing Recipes", utils.Logger.Args("backend", be, "identifiers", identifiers))
+	b, ok := backends.Backends[be]
+	if !ok {
+		utils.Logger.Error("Backend not found", utils.Logger.Args("backend", be))
+		return nil, errors.New("backend not found")
+	}
+	if !b.Ready() {
+		utils.Logger.Error("Backend not ready", utils.Logger.Args("backend", be))
+		return nil, errors.New("backend not ready")
+	}
+	if err := ScanLayers(); err != nil {
+		utils.Logger.Error("Failed to scan layers", utils.Logger.Args("error", err))
+		return nil, err
+	}
+
+	tracked := make(map[string]*RecipeEntry)
+	var ids []string
+	for _, e := range trackedRecipes() {
+		tracked[e.Identifier] = e
+		if len(identifiers) == 0 {
+			if _, err := b.LatestVersion(e.Identifier); err == nil {
+				ids = append(ids, e.Identifier)
+			}
+		}
+	}
+	if len(identifiers) > 0 {
+		ids = identifiers
+	}
+	for _, id := range ids {
+		e, ok := tracked[id]
+		if !ok {
+			results = append(results, &RefreshResult{Identifier: id, Status: RefreshFailed, Reason: "no recipe in " + viper.GetString("yocto.layerdirectory")})
+			continue
+		}
+		results = append(results, refreshRecipe(b, e))
+	}
+	return results, nil
+}
+
+func refreshRecipe(b backends.Backend, e *RecipeEntry) *RefreshResult {
+	cur := e.LayerVersion(viper.GetString("yocto.layerdirectory"))
+	res := &RefreshResult{Identifier: e.Identifier, Version: cur.Version}
+	fail := func(err error) *RefreshResult {
+		res.Status = RefreshFailed
+		res.Reason = err.Error()
+		return res
+	}
+
+	pn, _ := bitbake.SplitFileName(path.Base(cur.Path))
+	res.Path = path.Join(path.Dir(cur.Path), pn+".inc")
+	current, err := os.ReadFile(res.Path)
+	if err != nil {
+		return fail(err)
+	}
+
+	/* the version is upgrades business, refresh what we have */
+	s, err := b.GetRecipeVersion(e.Identifier, cur.Version, singleOptions())
+	if err != nil {
+		return fail(err)
+	}
+	applyOverrides(e.Identifier, s)
+	res.Overrides = s.Overrides
+	if unresolved := resolveDepends(s); len(unresolved) > 0 {
+		utils.Logger.Warn("Refreshed recipe has unresolved dependancies", utils.Logger.Args("recipe", e.Identifier, "depends", strings.Join(unresolved, " ")))
+	}
+	files, err := renderRecipeFiles(s)
+	if err != nil {
+		return fail(err)
+	}
+	rendered := files[len(files)-1]
+
+	content, conflicts, err := replaceManaged(string(current), string(rendered.Content))
+	if err != nil {
+		return fail(fmt.Errorf("%s: %w", res.Path, err))
+	}
+	res.Conflicts = conflicts
+	for _, c := range conflicts {
+		utils.Logger.Warn("Managed variable is also set by hand", utils.Logger.Args("recipe", e.Identifier, "variable", c, "file", res.Path))
+	}
+	if content == string(current) {
+		res.Status = RefreshUnchanged
+		return res
+	}
+
+	layerdir := viper.GetString("yocto.layerdirectory")
+	rel, err := relPath(layerdir, res.Path)
+	if err != nil {
+		return fail(err)
+	}
+	out := []recipeFile{{Path: rel, Content: []byte(content)}}
+	if viper.GetBool("recipe.dryrun") || viper.GetBool("recipe.diff") {
+		if err := previewRecipeFiles(out); err != nil {
+			return fail(err)
+		}
+		res.Status = RefreshRefreshed
+		return res
+	}
+	t, err := newTransaction(layerdir)
+	if err != nil {
+		return fail(err)
+	}
+	defer t.close()
+	if err := t.stage(rel, out[0].Content); err != nil {
+		return fail(err)
+	}
+	if err := t.commit(); err != nil {
+		return fail(err)
+	}
+	utils.Logger.Info("Refreshed " + res.Path)
+	res.Status = RefreshRefreshed
+	return res
+}
+
+/* relPath returns file relative to dir */
+func relPath(dir string, file string) (string, error) {
+	absdir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absfile, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(absdir, absfile)
+}
@@ -0,0 +1,143 @@
+package recipe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Fishwaldo/go-yocto/backends"
+	"github.com/Fishwaldo/go-yocto/source"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/pterm/pterm"
+	"github.com/spf13/viper"
+)
+
+/* OutdatedRecipe compares a recipe of the layer with the newest release a
+ * backend knows about */
+type OutdatedRecipe struct {
+	Identifier string `json:"identifier" yaml:"identifier"`
+	Backend    string `json:"backend" yaml:"backend"`
+	Path       string `json:"path" yaml:"path"`
+	Current    string `json:"current" yaml:"current"`
+	Latest     string `json:"latest" yaml:"latest"`
+	Released   string `json:"released,omitempty" yaml:"released,omitempty"`
+	AgeDays    int    `json:"age_days,omitempty" yaml:"age_days,omitempty"`
+	Prerelease bool   `json:"prerelease" yaml:"prerelease"`
+	Origin     string `json:"origin" yaml:"origin"`
+	Outdated   bool   `json:"outdated" yaml:"outdated"`
+}
+
+/* OutdatedRecipes checks every recipe of the layer against the releases of
+ * the backends. With be set only that backend is asked, otherwise the
+ * first backend that knows about a recipe is used */
+func OutdatedRecipes(be string) (report []*OutdatedRecipe, err error) {
+	utils.Logger.Trace("Checking for outdated Recipes", utils.Logger.Args("backend", be))
+	var bes []backends.Backend
+	if be != "" {
+		b, ok := backends.Backends[be]
+		if !ok {
+			utils.Logger.Error("Backend not found", utils.Logger.Args("backend", be))
+			return nil, errors.New("backend not found")
+		}
+		bes = append(bes, b)
+	} else {
+		var names []string
+		for name := range backends.Backends {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			bes = append(bes, backends.Backends[name])
+		}
+	}
+	if err := ScanLayers(); err != nil {
+		utils.Logger.Error("Failed to scan layers", utils.Logger.Args("error", err))
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, e := range trackedRecipes() {
+		cur := e.LayerVersion(viper.GetString("yocto.layerdirectory"))
+		for _, b := range bes {
+			if !b.Ready() {
+				continue
+			}
+			releases, err := b.Releases(e.Identifier)
+			if err != nil {
+				continue
+			}
+			report = append(report, compareReleases(e.Identifier, b.GetName(), cur, releases, now))
+			break
+		}
+	}
+	return report, nil
+}
+
+/* compareReleases picks the newest stable release newer than the recipe,
+ * or failing that the newest prerelease. Releases only announced in
+ * AppStream have no tarball to upgrade to, so they are not counted */
+func compareReleases(id string, be string, cur *RecipeVersion, releases []source.Release, now time.Time) *OutdatedRecipe {
+	o := &OutdatedRecipe{Identifier: id, Backend: be, Path: cur.Path, Current: cur.Version, Latest: cur.Version}
+	var stable, pre *source.Release
+	for i := range releases {
+		r := &releases[i]
+		if r.Origin == "appstream" || vercmp(r.Version, cur.Version) <= 0 {
+			continue
+		}
+		if r.Prerelease {
+			if pre == nil || vercmp(r.Version, pre.Version) > 0 {
+				pre = r
+			}
+		} else if stable == nil || vercmp(r.Version, stable.Version) > 0 {
+			stable = r
+		}
+	}
+	latest := stable
+	if latest == nil {
+		latest = pre
+	}
+	if latest == nil {
+		return o
+	}
+	o.Outdated = true
+	o.Latest = latest.Version
+	o.Prerelease = latest.Prerelease
+	o.Origin = latest.Origin
+	if !latest.Date.IsZero() {
+		o.Released = latest.Date.Format("2006-01-02")
+		o.AgeDays = int(now.Sub(latest.Date).Hours() / 24)
+	}
+	return o
+}
+
+/* WriteOutdated writes the report as a table, or markdown for CI */
+func WriteOutdated(w io.Writer, report []*OutdatedRecipe, markdown bool) error {
+	header := []string{"Recipe", "Backend", "Current", "Latest", "Released", "Age", "Prerelease"}
+	var rows [][]string
+	for _, o := range report {
+		age := ""
+		if o.Released != "" {
+			age = strconv.Itoa(o.AgeDays) + " days"
+		}
+		pre := ""
+		if o.Prerelease {
+			pre = "yes"
+		}
+		rows = append(rows, []string{o.Identifier, o.Backend, o.Current, o.Latest, o.Released, age, pre})
+	}
+	if markdown {
+		fmt.Fprintln(w, "| "+strings.Join(header, " | ")+" |")
+		fmt.Fprintln(w, "|"+strings.Repeat(" --- |", len(header)))
+		for _, row := range rows {
+			fmt.Fprintln(w, "| "+strings.Join(row, " | ")+" |")
+		}
+		return nil
+	}
+	td := pterm.TableData{header}
+	td = append(td, rows...)
+	return pterm.DefaultTable.WithHasHeader().WithData(td).WithWriter(w).Render()
+}
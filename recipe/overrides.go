@@ -0,0 +1,282 @@
+package recipe
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/answers"
+	"github.com/Fishwaldo/go-yocto/backends"
+	"github.com/Fishwaldo/go-yocto/source"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+/* ListOverride adds entries to, or removes them from, a list */
+type ListOverride struct {
+	Add    []string `yaml:"add,omitempty"`
+	Remove []string `yaml:"remove,omitempty"`
+}
+
+/* Override holds the manual fixes to a recipe that have to survive its
+ * regeneration */
+type Override struct {
+	Version   string            `yaml:"version,omitempty"`
+	Section   string            `yaml:"section,omitempty"`
+	Name      string            `yaml:"name,omitempty"`
+	Depends   ListOverride      `yaml:"depends,omitempty"`
+	Inherits  ListOverride      `yaml:"inherits,omitempty"`
+	Variables map[string]string `yaml:"variables,omitempty"`
+}
+
+type overridesFile struct {
+	Overrides map[string]Override `yaml:"overrides"`
+}
+
+var overrides map[string]Override
+
+func init() {
+	viper.SetDefault("overrides.layerfile", "conf/go-yocto-overrides.yaml")
+}
+
+/* OverridesFile returns the overrides file of the layer we manage */
+func OverridesFile() string {
+	return path.Join(viper.GetString("yocto.layerdirectory"), viper.GetString("overrides.layerfile"))
+}
+
+/* loadOverrides reads the overrides file of the layer, if there is one */
+func loadOverrides() error {
+	overrides = nil
+	file := OverridesFile()
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			utils.Logger.Trace("No overrides file", utils.Logger.Args("file", file))
+			return nil
+		}
+		utils.Logger.Error("Failed to read overrides file", utils.Logger.Args("file", file, "error", err))
+		return err
+	}
+	var of overridesFile
+	if err := yaml.Unmarshal(raw, &of); err != nil {
+		utils.Logger.Error("Failed to unmarshal overrides file", utils.Logger.Args("file", file, "error", err))
+		return err
+	}
+	utils.Logger.Trace("Loaded overrides file", utils.Logger.Args("file", file, "entries", len(of.Overrides)))
+	overrides = of.Overrides
+	return nil
+}
+
+/* matchingOverrides returns the keys of the overrides for a recipe. Glob
+ * patterns come first, least specific first, and an exact key last, so
+ * the most specific override has the final say */
+func matchingOverrides(identifier string) (keys []string) {
+	for k := range overrides {
+		if k == identifier || !strings.ContainsAny(k, "*?[") {
+			continue
+		}
+		if ok, _ := filepath.Match(k, identifier); ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if len(keys[a]) != len(keys[b]) {
+			return len(keys[a]) < len(keys[b])
+		}
+		return keys[a] < keys[b]
+	})
+	if _, ok := overrides[identifier]; ok {
+		keys = append(keys, identifier)
+	}
+	return keys
+}
+
+/* singleOptions are the options for getting one recipe at a time, which
+ * may prompt unless --non-interactive is given or we run in CI */
+func singleOptions() source.Options {
+	return source.Options{Interactive: answers.Interactive()}
+}
+
+/* pinnedVersion returns the version an override pins a recipe to */
+func pinnedVersion(identifier string) string {
+	version := ""
+	for _, k := range matchingOverrides(identifier) {
+		if v := overrides[k].Version; v != "" {
+			version = v
+		}
+	}
+	return version
+}
+
+/* resolveVersion returns the newest version with a tarball that satisfies
+ * a version constraint, such as ~5.104. Versions are returned as they are */
+func resolveVersion(b backends.Backend, identifier string, version string) (string, error) {
+	if !source.IsConstraint(version) {
+		return version, nil
+	}
+	releases, err := b.Releases(identifier)
+	if err != nil {
+		return "", err
+	}
+	var downloads []source.Release
+	for _, r := range releases {
+		if r.Origin != "appstream" {
+			downloads = append(downloads, r)
+		}
+	}
+	r, err := source.SelectVersion(downloads, version)
+	if err != nil {
+		return "", err
+	}
+	return r.Version, nil
+}
+
+/* getRecipe gets a recipe from the backend with the overrides of the layer
+ * applied. A version constraint from the overrides is resolved first, as
+ * the backend only fetches exact versions */
+func getRecipe(b backends.Backend, identifier string, opts source.Options) (*source.RecipeSource, error) {
+	version, err := resolveVersion(b, identifier, pinnedVersion(identifier))
+	if err != nil {
+		utils.Logger.Error("Failed to resolve version", utils.Logger.Args("recipe", identifier, "version", pinnedVersion(identifier), "error", err))
+		return nil, err
+	}
+	var s *source.RecipeSource
+	if version != "" {
+		s, err = b.GetRecipeVersion(identifier, version, opts)
+	} else {
+		s, err = b.GetRecipe(identifier, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	applyOverrides(identifier, s)
+	return s, nil
+}
+
+/* applyOverrides applies the matching overrides to a recipe and records
+ * the ones that changed something in its Overrides */
+func applyOverrides(identifier string, s *source.RecipeSource) {
+	for _, k := range matchingOverrides(identifier) {
+		o := overrides[k]
+		var changes []string
+		if o.Version != "" {
+			changes = append(changes, "version "+o.Version)
+		}
+		if o.Section != "" && o.Section != s.Section {
+			s.Section = o.Section
+			changes = append(changes, "section "+o.Section)
+		}
+		if o.Name != "" && o.Name != s.Identifier {
+			changes = append(changes, "name "+s.Identifier+" -> "+o.Name)
+			s.Identifier = o.Name
+			s.Name = o.Name
+		}
+		var c []string
+		s.Depends, c = o.Depends.apply(s.Depends)
+		if len(c) > 0 {
+			changes = append(changes, "depends "+strings.Join(c, " "))
+		}
+		s.Inherits, c = o.Inherits.apply(s.Inherits)
+		if len(c) > 0 {
+			changes = append(changes, "inherits "+strings.Join(c, " "))
+		}
+		var names []string
+		for name := range o.Variables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			s.Variables = setVariable(s.Variables, name, o.Variables[name])
+			changes = append(changes, "set "+name)
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		utils.Logger.Info("Applied override", utils.Logger.Args("recipe", identifier, "override", k, "changes", strings.Join(changes, ", ")))
+		s.Overrides = append(s.Overrides, k)
+	}
+}
+
+func (l ListOverride) apply(list []string) (result []string, changes []string) {
+	for _, v := range list {
+		if contains(l.Remove, v) {
+			changes = append(changes, "-"+v)
+			continue
+		}
+		result = append(result, v)
+	}
+	for _, v := range l.Add {
+		if !contains(result, v) {
+			result = append(result, v)
+			changes = append(changes, "+"+v)
+		}
+	}
+	return result, changes
+}
+
+func setVariable(vars []source.Variable, name string, value string) []source.Variable {
+	for i := range vars {
+		if vars[i].Name == name {
+			vars[i].Value = value
+			return vars
+		}
+	}
+	return append(vars, source.Variable{Name: name, Value: value})
+}
+
+/* saveOverride merges o into the override for identifier in the layers
+ * overrides file, creating it if needed */
+func saveOverride(identifier string, o Override) (string, error) {
+	file, of, out, err := mergeOverride(identifier, o)
+	if err != nil {
+		return file, err
+	}
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		return file, err
+	}
+	if err := os.WriteFile(file, out, 0644); err != nil {
+		return file, err
+	}
+	overrides = of.Overrides
+	return file, nil
+}
+
+/* mergeOverride returns the overrides file and what it would hold with o
+ * merged in, without writing it */
+func mergeOverride(identifier string, o Override) (string, overridesFile, []byte, error) {
+	file := OverridesFile()
+	var of overridesFile
+	raw, err := os.ReadFile(file)
+	if err == nil {
+		if err := yaml.Unmarshal(raw, &of); err != nil {
+			utils.Logger.Error("Failed to unmarshal overrides file", utils.Logger.Args("file", file, "error", err))
+			return file, of, nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return file, of, nil, err
+	}
+	if of.Overrides == nil {
+		of.Overrides = make(map[string]Override)
+	}
+	cur := of.Overrides[identifier]
+	if o.Version != "" {
+		cur.Version = o.Version
+	}
+	for _, d := range o.Depends.Remove {
+		if !contains(cur.Depends.Remove, d) {
+			cur.Depends.Remove = append(cur.Depends.Remove, d)
+		}
+	}
+	for _, d := range o.Depends.Add {
+		if !contains(cur.Depends.Add, d) {
+			cur.Depends.Add = append(cur.Depends.Add, d)
+		}
+	}
+	of.Overrides[identifier] = cur
+	out, err := yaml.Marshal(&of)
+	return file, of, out, err
+}
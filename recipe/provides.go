@@ -0,0 +1,170 @@
+package recipe
+
+import (
+	_ "embed"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/mapping"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+/* Provider records a recipe that satisfies a dependency name */
+type Provider struct {
+	Name   string
+	Recipe string
+	Kind   string
+	Source string
+}
+
+type providesEntry struct {
+	PkgConfig []string `yaml:"pkgconfig"`
+	CMake     []string `yaml:"cmake"`
+	Provides  []string `yaml:"provides"`
+}
+
+//go:embed provides.yaml
+var curatedProvides []byte
+
+var providesIndex map[string][]Provider = make(map[string][]Provider)
+
+func init() {
+	viper.SetDefault("provides.layerfile", "conf/go-yocto-provides.yaml")
+}
+
+func addProvider(p Provider) {
+	key := strings.ToLower(strings.TrimSuffix(p.Name, ".pc"))
+	for _, e := range providesIndex[key] {
+		if e.Recipe == p.Recipe && e.Kind == p.Kind {
+			return
+		}
+	}
+	providesIndex[key] = append(providesIndex[key], p)
+}
+
+func loadProvidesTable(raw []byte, source string) error {
+	var table map[string]providesEntry
+	if err := yaml.Unmarshal(raw, &table); err != nil {
+		utils.Logger.Error("Failed to unmarshal provides table", utils.Logger.Args("source", source, "error", err))
+		return err
+	}
+	for recipe, e := range table {
+		for _, n := range e.PkgConfig {
+			addProvider(Provider{Name: n, Recipe: recipe, Kind: "pkgconfig", Source: source})
+		}
+		for _, n := range e.CMake {
+			addProvider(Provider{Name: n, Recipe: recipe, Kind: "cmake", Source: source})
+		}
+		for _, n := range e.Provides {
+			addProvider(Provider{Name: n, Recipe: recipe, Kind: "provides", Source: source})
+		}
+	}
+	return nil
+}
+
+/* buildProvidesIndex loads the built-in dependency mappings and the
+ * curated provides tables, and indexes the recipes found by scanRecipes */
+func buildProvidesIndex(layers []string) error {
+	utils.ClearMap(providesIndex)
+	builtin, err := mapping.Builtin()
+	if err != nil {
+		return err
+	}
+	for _, m := range builtin {
+		addProvider(Provider{Name: m.Key, Recipe: m.Recipe, Kind: "mapping", Source: m.Source})
+	}
+	if err := loadProvidesTable(curatedProvides, "curated"); err != nil {
+		return err
+	}
+	for _, layer := range layers {
+		file := path.Join(layer, viper.GetString("provides.layerfile"))
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				utils.Logger.Error("Failed to read provides table", utils.Logger.Args("file", file, "error", err))
+			}
+			continue
+		}
+		if err := loadProvidesTable(raw, file); err != nil {
+			return err
+		}
+	}
+	for id, e := range existing.Recipes {
+		for _, v := range e.Versions {
+			addProvider(Provider{Name: id, Recipe: id, Kind: "recipe", Source: v.Path})
+			for _, p := range harvestProvides(id, v) {
+				addProvider(p)
+			}
+		}
+		for _, variant := range e.Variants {
+			addProvider(Provider{Name: variant, Recipe: id, Kind: "variant", Source: e.Preferred().Path})
+		}
+	}
+	return nil
+}
+
+/* harvestProvides picks up the PROVIDES of a recipe and any pkg-config
+ * files shipped alongside it */
+func harvestProvides(id string, v *RecipeVersion) (providers []Provider) {
+	for _, p := range strings.Fields(v.Recipe.Get("PROVIDES")) {
+		providers = append(providers, Provider{Name: p, Recipe: id, Kind: "provides", Source: v.Path})
+	}
+	pcs, _ := filepath.Glob(path.Join(path.Dir(v.Path), "*", "*.pc*"))
+	for _, pc := range pcs {
+		name := strings.TrimSuffix(path.Base(pc), ".in")
+		if path.Ext(name) == ".pc" {
+			providers = append(providers, Provider{Name: name, Recipe: id, Kind: "pkgconfig", Source: pc})
+		}
+	}
+	return providers
+}
+
+/* LookupProvides returns the recipes providing a name. The name may be a
+ * recipe, a PROVIDES entry, a pkg-config module (with or without .pc) or a
+ * CMake config package, and is matched case-insensitively */
+func LookupProvides(name string) []Provider {
+	return providesIndex[strings.ToLower(strings.TrimSuffix(name, ".pc"))]
+}
+
+/* SearchProvides returns every provider whose name contains keyword */
+func SearchProvides(keyword string) (providers []Provider) {
+	keyword = strings.ToLower(keyword)
+	for key, p := range providesIndex {
+		if strings.Contains(key, keyword) {
+			providers = append(providers, p...)
+		}
+	}
+	sort.Slice(providers, func(a, b int) bool {
+		if providers[a].Name != providers[b].Name {
+			return providers[a].Name < providers[b].Name
+		}
+		return providers[a].Recipe < providers[b].Recipe
+	})
+	return providers
+}
+
+/* resolveDepend maps a discovered build dependency to an existing recipe.
+ * Native dependencies are resolved through their target recipe */
+func resolveDepend(dep string) (string, bool) {
+	if _, ok := existing.Lookup(dep); ok {
+		return dep, true
+	}
+	suffix := ""
+	name := dep
+	if strings.HasSuffix(dep, "-native") {
+		suffix = "-native"
+		name = strings.TrimSuffix(dep, "-native")
+	}
+	for _, p := range LookupProvides(name) {
+		if _, ok := existing.Lookup(p.Recipe + suffix); ok {
+			return p.Recipe + suffix, true
+		}
+	}
+	return dep, false
+}
@@ -1,204 +1,286 @@
 package recipe
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
-	"io/fs"
-	"io/ioutil"
+	"io"
 	"os"
 	"path"
-	"path/filepath"
-	"regexp"
 	"strings"
 	"text/template"
 
 	"github.com/Fishwaldo/go-yocto/backends"
+	"github.com/Fishwaldo/go-yocto/layer"
+	"github.com/Fishwaldo/go-yocto/output"
 	"github.com/Fishwaldo/go-yocto/source"
+	"github.com/Fishwaldo/go-yocto/templates"
 	"github.com/Fishwaldo/go-yocto/utils"
 	"github.com/spf13/viper"
 	"github.com/pterm/pterm"
 //	"github.com/davecgh/go-spew/spew"
 )
 
-var (
-	funcs     = template.FuncMap{"join": strings.Join}
-	parserecipename = regexp.MustCompile(`^(.*)_(.*)\.bb$`)
-	existingRecipes map[string]*source.RecipeSource = make(map[string]*source.RecipeSource)
-
-)
-
-
 func init() {
 }
 
 
-func CreateRecipe(be string, name string) (error) {
+/* CreateRecipe creates a recipe and returns the sources written, which
+ * with --with-deps includes the dependancies created for it */
+func CreateRecipe(be string, name string) (created []*source.RecipeSource, err error) {
 	utils.Logger.Trace("Creating Recipe", utils.Logger.Args("backend", be, "name", name))
 	b, ok := backends.Backends[be]
 	if !ok {
 		utils.Logger.Error("Backend not found", utils.Logger.Args("backend", be))
-		return errors.New("backend not found")
+		return nil, errors.New("backend not found")
 	}
 	if !b.Ready() {
 		utils.Logger.Error("Backend not ready", utils.Logger.Args("backend", be))
-		return errors.New("backend not ready")
+		return nil, errors.New("backend not ready")
 	}
 
 
-	layers := viper.GetStringSlice("yocto.layers")
-	for _, layer := range layers {
-		spinnerInfo, _ := pterm.DefaultSpinner.Start("Scanning Existing Recipe Files in " + layer)
-		scanRecipes(layer, 0);
-		spinnerInfo.Success()
+	if err := ScanLayers(); err != nil {
+		utils.Logger.Error("Failed to scan layers", utils.Logger.Args("error", err))
+		return nil, err
 	}
-	s, err := b.GetRecipe(name)
+
+	if viper.GetBool("recipe.withdeps") {
+		return createWithDepends(b, name)
+	}
+
+	s, err := getRecipe(b, name, singleOptions())
 	if err != nil {
 		utils.Logger.Error("Failed to get Recipe", utils.Logger.Args("backend", be, "name", name, "error", err))
-		return err
+		return nil, err
 	}
 
-	/* if it already exists, bail out */
-	if _, ok := existingRecipes[s.Identifier]; ok {
-		utils.Logger.Warn("Recipe already exists", utils.Logger.Args("recipe", s.Name))
-		return errors.New("recipe already exists")
+	/* if it already exists, or another recipe provides it, bail out,
+	 * before the wizard asks anything */
+	if e, ok := existing.Lookup(s.Identifier); ok {
+		utils.Logger.Warn("Recipe already exists", utils.Logger.Args("recipe", s.Name, "existing", e.Identifier, "location", e.Preferred().Path))
+		/* a preview is still useful, it shows what would change */
+		if !viper.GetBool("recipe.dryrun") && !viper.GetBool("recipe.diff") {
+			return nil, errors.New("recipe already exists")
+		}
 	}
 
-	/* check out dependancies */
-	for _, dep := range s.Depends {
-		if _, ok := existingRecipes[dep]; !ok {
-			utils.Logger.Warn("Recipe Dependancy not found", utils.Logger.Args("recipe", s.Name, "dependancy", dep))
-			return errors.New("recipe dependancy not found")
+	if viper.GetBool("recipe.wizard") {
+		var missing []string
+		if s, missing, err = runWizard(b, name, s); err != nil {
+			return nil, err
 		}
+		/* the wizard resolved the dependancies already, what it left
+		 * unresolved is what the user asked for */
+		if len(missing) > 0 {
+			pterm.Warning.Println("Unresolved dependancies for " + s.Identifier + ", kept as asked: " + strings.Join(missing, ", "))
+		}
+	} else if unresolved := resolveDepends(s); len(unresolved) > 0 {
+		/* check out dependancies, resolving pkg-config and cmake names
+		 * to the recipes that provide them */
+		pterm.Warning.Println("Unresolved dependancies for " + s.Identifier + ": " + strings.Join(unresolved, ", "))
+		return nil, errors.New("recipe dependancy not found")
 	}
 
 	if err := writeRecipeFiles(s); err != nil {
 		utils.Logger.Error("Failed to write Recipe Files", utils.Logger.Args("error", err))
-		return err
+		return nil, err
 	}
-	return nil
+	return []*source.RecipeSource{s}, nil
 }
 
-func writeRecipeFiles(s *source.RecipeSource) (error) {
-	dir := path.Join(viper.GetString("yocto.layerdirectory"), "recipes-" + s.Section)
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		if err := os.Mkdir(dir, 0755); err != nil {
-			utils.Logger.Error("Failed to create directory", utils.Logger.Args("error", err, "dir", dir))
-			return err
+/* resolveDepends rewrites the recipes DEPENDS to existing recipes and
+ * returns the ones that could not be resolved */
+func resolveDepends(s *source.RecipeSource) (unresolved []string) {
+	for i, dep := range s.Depends {
+		if r, ok := resolveDepend(dep); ok {
+			if r != dep {
+				utils.Logger.Info("Resolved Dependancy", utils.Logger.Args("recipe", s.Name, "dependancy", dep, "provider", r))
+			}
+			s.Depends[i] = r
+		} else {
+			utils.Logger.Warn("Recipe Dependancy not found", utils.Logger.Args("recipe", s.Name, "dependancy", dep))
+			unresolved = append(unresolved, dep)
 		}
 	}
+	return unresolved
+}
 
-	dir = path.Join(dir, s.Identifier)
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		if err := os.Mkdir(dir, 0755); err != nil {
-			utils.Logger.Error("Failed to create directory", utils.Logger.Args("error", err))
-			return err
+/* recipeFile is a rendered file, relative to the layer */
+type recipeFile struct {
+	Path    string
+	Content []byte
+	/* Replaces is a file of the layer this one takes the place of, and
+	 * that is removed when it is written */
+	Replaces string
+}
+
+/* renderRecipeFiles renders the .bb and .inc of a recipe, and the release
+ * include if it has yet to be created */
+func renderRecipeFiles(s *source.RecipeSource) (files []recipeFile, err error) {
+	dir := path.Join("recipes-" + s.Section, s.Identifier)
+
+	if s.ReleaseGroup != "" {
+		if f, err := renderReleaseInclude(s); err != nil {
+			utils.Logger.Error("Failed to render release include", utils.Logger.Args("error", err, "group", s.ReleaseGroup))
+			return nil, err
+		} else if f != nil {
+			files = append(files, *f)
 		}
 	}
 
-	utils.Logger.Info("Publishing to " + dir)
-
-	maintmpl, err := ioutil.ReadFile("templates/recipe-main.tmpl")
+	/* pick the templates for the backend, build system and section */
+	maintmplname, inctmplname := templates.Select(s)
+	maintmpl, err := templates.Read(maintmplname, s.BackendID)
 	if err != nil {
 		utils.Logger.Error("Failed to read main template", utils.Logger.Args("error", err))
-	} else {
-
-		/* create recipe_version.bb file */
-		masterTmpl, err := template.New("master").Funcs(funcs).Parse(string(maintmpl))
-		if err != nil {
-			utils.Logger.Error("Failed to parse template", utils.Logger.Args("error", err))
-			return err
-		}
+		return nil, err
+	}
+	/* create recipe_version.bb file */
+	masterTmpl, err := template.New("master").Funcs(templates.Funcs).Parse(string(maintmpl))
+	if err != nil {
+		utils.Logger.Error("Failed to parse template", utils.Logger.Args("error", err))
+		return nil, err
+	}
+	if err := templates.AddPartials(masterTmpl, s.BackendID); err != nil {
+		return nil, err
+	}
+	var bb bytes.Buffer
+	if err := masterTmpl.Execute(&bb, s); err != nil {
+		utils.Logger.Error("Failed to execute template", utils.Logger.Args("error", err))
+		return nil, err
+	}
+	files = append(files, recipeFile{Path: path.Join(dir, fmt.Sprintf("%s_%s.bb", s.Identifier, s.Version)), Content: bb.Bytes()})
 
-		fname := path.Join(dir, fmt.Sprintf("%s_%s.bb", s.Identifier, s.Version))
+	/* create recipe.inc file */
+	inctmpl, err := templates.Read(inctmplname, s.BackendID)
+	if err != nil {
+		utils.Logger.Error("Failed to read include template", utils.Logger.Args("error", err))
+		return nil, err
+	}
+	overlayTmpl, err := template.Must(masterTmpl.Clone()).Parse(string(inctmpl))
+	if err != nil {
+		utils.Logger.Error("Failed to parse template", utils.Logger.Args("error", err))
+		return nil, err
+	}
+	var inc bytes.Buffer
+	if err := overlayTmpl.Execute(&inc, s); err != nil {
+		utils.Logger.Error("Failed to execute template", utils.Logger.Args("error", err))
+		return nil, err
+	}
+	files = append(files, recipeFile{Path: path.Join(dir, fmt.Sprintf("%s.inc", s.Identifier)), Content: inc.Bytes()})
+	return files, nil
+}
 
-		if f, err := os.Create(fname); err != nil {
-    		utils.Logger.Error("Failed to create file", utils.Logger.Args("error", err))
-			return err	
-		} else {
-			if err := masterTmpl.Execute(f, s); err != nil {
-				utils.Logger.Error("Failed to execute template", utils.Logger.Args("error", err))
-				return err
-			} else {
-				utils.Logger.Info("Created " + fname)
-			}
-			f.Close();
-		}
+func writeRecipeFiles(s *source.RecipeSource) (error) {
+	files, err := renderRecipeFiles(s)
+	if err != nil {
+		return err
+	}
+	if viper.GetBool("recipe.dryrun") || viper.GetBool("recipe.diff") {
+		return previewRecipeFiles(files)
+	}
 
-		/* create recipe.inc file */
-		maintmpl, err := ioutil.ReadFile("templates/recipe-include.tmpl")
-		if err != nil {
-			utils.Logger.Error("Failed to read main template", utils.Logger.Args("error", err))
-		} else {
-			overlayTmpl, err := template.Must(masterTmpl.Clone()).Parse(string(maintmpl))
-			if err != nil {
-				utils.Logger.Error("Failed to parse template", utils.Logger.Args("error", err))
-				return err
-			}
-			fname = path.Join(dir, fmt.Sprintf("%s.inc", s.Identifier))
-
-			if f, err := os.Create(fname); err != nil {
-				utils.Logger.Error("Failed to create file", utils.Logger.Args("error", err))
-				return err	
-			} else {
-				if err := overlayTmpl.Execute(f, s); err != nil {
-					utils.Logger.Error("Failed to execute template", utils.Logger.Args("error", err))
-					return err
-				} else {
-					utils.Logger.Info("Created " + fname)
-				}
-				f.Close();
-			}
-		}
+	layerdir := viper.GetString("yocto.layerdirectory")
+	utils.Logger.Info("Publishing to " + path.Join(layerdir, path.Dir(files[len(files)-1].Path)))
+	if err := commitRecipeFiles(files); err != nil {
+		return err
+	}
+	for _, f := range files {
+		utils.Logger.Info("Created " + path.Join(layerdir, f.Path))
 	}
 	return nil
 }
 
-
-func scanRecipes(dir string, level int) (error) {
-
-	fsrecipessections, err := os.ReadDir(dir)
+/* commitRecipeFiles writes files into the layer, and removes the ones they
+ * replace. Everything is staged first, so a failure never leaves half a
+ * change in the layer */
+func commitRecipeFiles(files []recipeFile) error {
+	t, err := newTransaction(viper.GetString("yocto.layerdirectory"))
 	if err != nil {
-		utils.Logger.Error("Failed to read directory", utils.Logger.Args("error", err))
+		utils.Logger.Error("Failed to create staging directory", utils.Logger.Args("error", err))
 		return err
 	}
+	defer t.close()
+	for _, f := range files {
+		if err := t.stage(f.Path, f.Content); err != nil {
+			utils.Logger.Error("Failed to stage file", utils.Logger.Args("file", f.Path, "error", err))
+			return err
+		}
+		if f.Replaces != "" {
+			t.remove(f.Replaces)
+		}
+	}
+	return t.commit()
+}
 
-	for _, file := range fsrecipessections {
-		if file.IsDir() {
-			if (level == 0) { 
-				ok, _ := filepath.Match("recipes-*", file.Name())
-				if !ok {
-					continue
-				}
-			}
-			if err := scanRecipes(path.Join(dir, file.Name()), level + 1); err != nil {
-				utils.Logger.Error("Failed to scan directory", utils.Logger.Args("error", err))
-				continue
-			}
-		} else if file.Type().IsRegular() {
-			if strings.EqualFold(path.Ext(file.Name()), ".bb") {
-				if err := parseRecipeFile(file, path.Join(dir, file.Name())); err != nil {
-					utils.Logger.Error("Failed to parse recipe file", utils.Logger.Args("error", err, "file", path.Join(dir, file.Name())))
-					continue
-				}
+var previewChanged bool
+
+/* PreviewChanged reports if a --dry-run or --diff found files that would
+ * be written differently to what is on disk */
+func PreviewChanged() bool {
+	return previewChanged
+}
+
+/* previewRecipeFiles prints the rendered files, or with --diff a unified
+ * diff against the files in the layer, instead of writing them */
+func previewRecipeFiles(files []recipeFile) error {
+	layerdir := viper.GetString("yocto.layerdirectory")
+	/* in machine mode stdout is kept for the results */
+	var w io.Writer = os.Stdout
+	if output.Machine() {
+		w = os.Stderr
+	}
+	for _, f := range files {
+		fname := path.Join(layerdir, f.Path)
+		oldpath := f.Path
+		if f.Replaces != "" {
+			oldpath = f.Replaces
+		}
+		current, err := os.ReadFile(path.Join(layerdir, oldpath))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if !bytes.Equal(current, f.Content) || errors.Is(err, os.ErrNotExist) || oldpath != f.Path {
+			previewChanged = true
+		}
+		if viper.GetBool("recipe.diff") {
+			oldname := "a/" + oldpath
+			if current == nil {
+				oldname = "/dev/null"
 			}
+			fmt.Fprint(w, unifiedDiff(oldname, "b/"+f.Path, string(current), string(f.Content)))
+			continue
 		}
+		fmt.Fprintf(w, "==> %s <==\n%s", fname, f.Content)
 	}
 	return nil
 }
 
-func parseRecipeFile(file fs.DirEntry, dir string) (error) {
-	if parserecipename.Match([]byte(file.Name())) { 
-		match := parserecipename.FindSubmatch([]byte(file.Name()))
-		s := source.RecipeSource{
-			Identifier: string(match[1]),
-			Version: string(match[2]),
-			Section: strings.TrimPrefix(file.Name(), "-"),
-			BackendID: "existing",
-			Location: path.Join(dir, file.Name()),
-		}
-		if _, ok := existingRecipes[s.Identifier]; !ok {
-			existingRecipes[s.Identifier] = &s
+
+/* ScanLayers scans the discovered layers for existing recipes and builds
+ * the provides index from them */
+func ScanLayers() (error) {
+	cleanStaging(viper.GetString("yocto.layerdirectory"))
+	layers, err := layer.Discover()
+	if err != nil {
+		return err
+	}
+	index := NewRecipeIndex()
+	index.bbpath = layer.Paths(layers)
+	for _, l := range layers {
+		spinnerInfo, _ := pterm.DefaultSpinner.Start("Scanning Existing Recipe Files in " + l.Path)
+		if l.HasConf {
+			scanLayerFiles(index, l)
+		} else {
+			scanRecipes(index, l.Path, l.Priority, l.Path, 0);
 		}
+		spinnerInfo.Success()
 	}
-	return nil
-}
\ No newline at end of file
+	index.finalize()
+	existing = index
+	if err := loadOverrides(); err != nil {
+		return err
+	}
+	return buildProvidesIndex(index.bbpath)
+}
@@ -0,0 +1,42 @@
+package recipe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/Fishwaldo/go-yocto/parsers/bitbake"
+	"github.com/Fishwaldo/go-yocto/source"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/spf13/viper"
+)
+
+/* ReleaseIncludePath returns the shared include holding the release of a
+ * release group, relative to the layer */
+func ReleaseIncludePath(group string) string {
+	return path.Join("include", group+"-release.inc")
+}
+
+/* renderReleaseInclude renders the shared include pinning the release of
+ * the recipes release group, or returns nil if it already exists. An
+ * include pinned to a different release is left alone, as the recipes
+ * already using it would be moved as well */
+func renderReleaseInclude(s *source.RecipeSource) (*recipeFile, error) {
+	fname := path.Join(viper.GetString("yocto.layerdirectory"), ReleaseIncludePath(s.ReleaseGroup))
+	if _, err := os.Stat(fname); err == nil {
+		r, err := bitbake.ParseConf(fname, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if current := r.Get(s.ReleaseVariable()); current != s.Release {
+			utils.Logger.Error("Release set mismatch", utils.Logger.Args("file", fname, "current", current, "release", s.Release))
+			return nil, fmt.Errorf("%s pins %s to %s, not %s", fname, s.ReleaseGroup, current, s.Release)
+		}
+		return nil, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	content := fmt.Sprintf("# SPDX-FileCopyrightText: none\n# SPDX-License-Identifier: CC0-1.0\n\n# Release of %s shared by every recipe in the group\n%s = \"%s\"\n", s.ReleaseGroup, s.ReleaseVariable(), s.Release)
+	return &recipeFile{Path: ReleaseIncludePath(s.ReleaseGroup), Content: []byte(content)}, nil
+}
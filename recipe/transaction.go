@@ -0,0 +1,262 @@
+package recipe
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/Fishwaldo/go-yocto/utils"
+)
+
+/* transaction writes a set of files into the layer all at once. Files are
+ * staged in a hidden directory inside the layer, so the final rename stays
+ * on one filesystem, and anything done to the layer is undone if a later
+ * file fails */
+type transaction struct {
+	layerdir string
+	staging  string
+	files    []string
+	created  []string
+	moved    []string
+	removals []string
+	removed  []string
+	backups  map[string]string
+}
+
+/* stagingPrefix names the staging directories, which carry the pid of the
+ * run that made them so a stale one can be told from one in use */
+const stagingPrefix = ".go-yocto-staging-"
+
+func newTransaction(layerdir string) (*transaction, error) {
+	if err := os.MkdirAll(layerdir, 0755); err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(layerdir, fmt.Sprintf("%s%d-", stagingPrefix, os.Getpid()))
+	if err != nil {
+		return nil, err
+	}
+	return &transaction{layerdir: layerdir, staging: staging, backups: make(map[string]string)}, nil
+}
+
+/* stage writes a file, relative to the layer, to the staging area */
+func (t *transaction) stage(rel string, content []byte) error {
+	fname := filepath.Join(t.staging, rel)
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(fname, content, 0644); err != nil {
+		return err
+	}
+	t.files = append(t.files, rel)
+	return nil
+}
+
+/* remove marks a file, relative to the layer, to be removed on commit */
+func (t *transaction) remove(rel string) {
+	t.removals = append(t.removals, rel)
+}
+
+/* commit moves the staged files into the layer. Interrupts are held back
+ * until it is done, and on failure the layer is rolled back */
+func (t *transaction) commit() (err error) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(sig)
+		select {
+		case s := <-sig:
+			/* deliver it again, now we are done */
+			if p, err := os.FindProcess(os.Getpid()); err == nil {
+				p.Signal(s)
+			}
+		default:
+		}
+	}()
+
+	for _, rel := range t.files {
+		if err = t.move(rel); err != nil {
+			utils.Logger.Error("Failed to move recipe file into layer, rolling back", utils.Logger.Args("file", rel, "error", err))
+			t.rollback()
+			return err
+		}
+	}
+	for _, rel := range t.removals {
+		if err = t.backup(filepath.Join(t.layerdir, rel), rel); err != nil {
+			utils.Logger.Error("Failed to remove file from layer, rolling back", utils.Logger.Args("file", rel, "error", err))
+			t.rollback()
+			return err
+		}
+		t.removed = append(t.removed, filepath.Join(t.layerdir, rel))
+	}
+	return nil
+}
+
+/* backup moves a file of the layer aside, so a rollback can restore it */
+func (t *transaction) backup(dest string, rel string) error {
+	backup := filepath.Join(t.staging, ".backup", rel)
+	if err := os.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(dest, backup); err != nil {
+		return err
+	}
+	t.backups[dest] = backup
+	return nil
+}
+
+func (t *transaction) move(rel string) error {
+	dest := filepath.Join(t.layerdir, rel)
+	if err := t.mkdirs(filepath.Dir(dest)); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(dest); err == nil {
+		if fi.IsDir() {
+			return errors.New(dest + " is a directory")
+		}
+		if err := t.backup(dest, rel); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Rename(filepath.Join(t.staging, rel), dest); err != nil {
+		if backup, ok := t.backups[dest]; ok {
+			os.Rename(backup, dest)
+			delete(t.backups, dest)
+		}
+		return err
+	}
+	t.moved = append(t.moved, dest)
+	return nil
+}
+
+/* mkdirs creates dir and its missing parents, remembering each one */
+func (t *transaction) mkdirs(dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := t.mkdirs(filepath.Dir(dir)); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return err
+	}
+	t.created = append(t.created, dir)
+	return nil
+}
+
+/* rollback puts back the files that were removed, removes the files moved
+ * into the layer, puts back the files they replaced and removes the
+ * directories that were created */
+func (t *transaction) rollback() {
+	for i := len(t.removed) - 1; i >= 0; i-- {
+		dest := t.removed[i]
+		if err := os.Rename(t.backups[dest], dest); err != nil {
+			utils.Logger.Error("Failed to restore file", utils.Logger.Args("file", dest, "error", err))
+		}
+	}
+	for i := len(t.moved) - 1; i >= 0; i-- {
+		dest := t.moved[i]
+		if err := os.Remove(dest); err != nil {
+			utils.Logger.Error("Failed to remove file", utils.Logger.Args("file", dest, "error", err))
+		}
+		if backup, ok := t.backups[dest]; ok {
+			if err := os.Rename(backup, dest); err != nil {
+				utils.Logger.Error("Failed to restore file", utils.Logger.Args("file", dest, "error", err))
+			}
+		}
+	}
+	for i := len(t.created) - 1; i >= 0; i-- {
+		if err := os.Remove(t.created[i]); err != nil {
+			utils.Logger.Error("Failed to remove directory", utils.Logger.Args("dir", t.created[i], "error", err))
+		}
+	}
+	t.moved = nil
+	t.removed = nil
+	t.created = nil
+}
+
+/* cleanStaging removes the staging directories that runs which were
+ * killed left behind in the layer. A file such a run had moved aside, and
+ * not yet replaced, is put back first */
+func cleanStaging(layerdir string) {
+	dirs, err := filepath.Glob(filepath.Join(layerdir, stagingPrefix+"*"))
+	if err != nil {
+		return
+	}
+	for _, dir := range dirs {
+		if stagingInUse(dir) {
+			continue
+		}
+		utils.Logger.Warn("Removing stale staging directory", utils.Logger.Args("dir", dir))
+		backups := filepath.Join(dir, ".backup")
+		filepath.WalkDir(backups, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(backups, p)
+			if err != nil {
+				return nil
+			}
+			dest := filepath.Join(layerdir, rel)
+			if _, err := os.Stat(dest); errors.Is(err, os.ErrNotExist) {
+				utils.Logger.Warn("Restoring file from stale staging directory", utils.Logger.Args("file", dest))
+				if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+					utils.Logger.Error("Failed to restore file", utils.Logger.Args("file", dest, "error", err))
+				} else if err := os.Rename(p, dest); err != nil {
+					utils.Logger.Error("Failed to restore file", utils.Logger.Args("file", dest, "error", err))
+				}
+			}
+			return nil
+		})
+		if err := os.RemoveAll(dir); err != nil {
+			utils.Logger.Error("Failed to remove staging directory", utils.Logger.Args("dir", dir, "error", err))
+		}
+	}
+}
+
+/* stagingInUse reports if the run that made a staging directory is still
+ * running */
+func stagingInUse(dir string) bool {
+	pid, _, ok := strings.Cut(strings.TrimPrefix(filepath.Base(dir), stagingPrefix), "-")
+	if !ok {
+		return false
+	}
+	n, err := strconv.Atoi(pid)
+	if err != nil {
+		return false
+	}
+	if n == os.Getpid() {
+		return true
+	}
+	p, err := os.FindProcess(n)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+/* inStaging reports if a file of a layer is inside a staging directory */
+func inStaging(file string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(file), "/") {
+		if strings.HasPrefix(part, stagingPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+/* close removes the staging area */
+func (t *transaction) close() {
+	if err := os.RemoveAll(t.staging); err != nil {
+		utils.Logger.Error("Failed to remove staging directory", utils.Logger.Args("dir", t.staging, "error", err))
+	}
+}
@@ -0,0 +1,324 @@
+package recipe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/backends"
+	"github.com/Fishwaldo/go-yocto/parsers/bitbake"
+	"github.com/Fishwaldo/go-yocto/source"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/spf13/viper"
+)
+
+/* UpgradeResult describes what changed when upgrading a recipe */
+type UpgradeResult struct {
+	Identifier      string   `json:"identifier" yaml:"identifier"`
+	OldVersion      string   `json:"old_version" yaml:"old_version"`
+	NewVersion      string   `json:"new_version,omitempty" yaml:"new_version,omitempty"`
+	Path            string   `json:"path,omitempty" yaml:"path,omitempty"`
+	Status          string   `json:"status" yaml:"status"`
+	Reason          string   `json:"reason,omitempty" yaml:"reason,omitempty"`
+	LicenseAdded    []string `json:"license_added,omitempty" yaml:"license_added,omitempty"`
+	LicenseRemoved  []string `json:"license_removed,omitempty" yaml:"license_removed,omitempty"`
+	DependsAdded    []string `json:"depends_added,omitempty" yaml:"depends_added,omitempty"`
+	DependsRemoved  []string `json:"depends_removed,omitempty" yaml:"depends_removed,omitempty"`
+	Overrides       []string `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+	releaseGroup    string
+	release         string
+	releaseVariable string
+	file            *recipeFile
+}
+
+const (
+	UpgradeUpgraded = "upgraded"
+	UpgradeCurrent  = "up to date"
+	UpgradeFailed   = "failed"
+)
+
+var (
+	srcurisha  = regexp.MustCompile(`^(\s*SRC_URI\[sha256sum\]\s*=\s*)"[^"]*"`)
+	srcuriline = regexp.MustCompile(`^\s*SRC_URI\s*=\s*"`)
+	releaseset = regexp.MustCompile(`(?m)^(\s*([A-Z0-9_]+_RELEASE)\s*\??=\s*)"[^"]*"`)
+)
+
+/* UpgradeRecipes moves existing recipes of the layer to the version the
+ * backend offers now. With no identifiers every recipe the layer tracks
+ * and the backend knows about is upgraded */
+func UpgradeRecipes(be string, identifiers []string) (results []*UpgradeResult, err error) {
+	utils.Logger.Trace("Upgrading Recipes", utils.Logger.Args("backend", be, "identifiers", identifiers))
+	b, ok := backends.Backends[be]
+	if !ok {
+		utils.Logger.Error("Backend not found", utils.Logger.Args("backend", be))
+		return nil, errors.New("backend not found")
+	}
+	if !b.Ready() {
+		utils.Logger.Error("Backend not ready", utils.Logger.Args("backend", be))
+		return nil, errors.New("backend not ready")
+	}
+	if err := ScanLayers(); err != nil {
+		utils.Logger.Error("Failed to scan layers", utils.Logger.Args("error", err))
+		return nil, err
+	}
+
+	var entries []*RecipeEntry
+	if len(identifiers) == 0 {
+		for _, e := range trackedRecipes() {
+			if _, err := b.LatestVersion(e.Identifier); err == nil {
+				entries = append(entries, e)
+			}
+		}
+	} else {
+		tracked := make(map[string]*RecipeEntry)
+		for _, e := range trackedRecipes() {
+			tracked[e.Identifier] = e
+		}
+		for _, id := range identifiers {
+			e, ok := tracked[id]
+			if !ok {
+				results = append(results, &UpgradeResult{Identifier: id, Status: UpgradeFailed, Reason: "no recipe in " + viper.GetString("yocto.layerdirectory")})
+				continue
+			}
+			entries = append(entries, e)
+		}
+	}
+
+	var files []recipeFile
+	for _, e := range entries {
+		res := upgradeRecipe(b, e)
+		results = append(results, res)
+		if res.file != nil {
+			files = append(files, *res.file)
+		}
+	}
+	incs, err := upgradeReleaseIncludes(results)
+	if err != nil {
+		return results, err
+	}
+	files = append(files, incs...)
+	if len(files) == 0 {
+		return results, nil
+	}
+
+	if viper.GetBool("recipe.dryrun") || viper.GetBool("recipe.diff") {
+		return results, previewRecipeFiles(files)
+	}
+	/* every recipe and release include moves in one go, or none does */
+	if err := commitRecipeFiles(files); err != nil {
+		for _, r := range results {
+			if r.Status == UpgradeUpgraded {
+				r.Status = UpgradeFailed
+				r.Reason = err.Error()
+			}
+		}
+		return results, err
+	}
+	for _, f := range files {
+		utils.Logger.Info("Upgraded "+path.Join(viper.GetString("yocto.layerdirectory"), f.Path), utils.Logger.Args("from", f.Replaces))
+	}
+	return results, nil
+}
+
+func upgradeRecipe(b backends.Backend, e *RecipeEntry) *UpgradeResult {
+	/* upgrade the newest version we carry in the layer */
+	cur := e.LayerVersion(viper.GetString("yocto.layerdirectory"))
+	res := &UpgradeResult{Identifier: e.Identifier, OldVersion: cur.Version, Path: cur.Path}
+
+	/* a version pinned by the overrides is as far as we go */
+	latest, err := resolveVersion(b, e.Identifier, pinnedVersion(e.Identifier))
+	if err != nil {
+		res.Status = UpgradeFailed
+		res.Reason = err.Error()
+		return res
+	}
+	if latest == "" {
+		var err error
+		if latest, err = b.LatestVersion(e.Identifier); err != nil {
+			res.Status = UpgradeFailed
+			res.Reason = err.Error()
+			return res
+		}
+	}
+	res.NewVersion = latest
+	if vercmp(latest, cur.Version) <= 0 {
+		res.Status = UpgradeCurrent
+		return res
+	}
+
+	s, err := b.GetRecipeVersion(e.Identifier, latest, singleOptions())
+	if err != nil {
+		res.Status = UpgradeFailed
+		res.Reason = err.Error()
+		return res
+	}
+	applyOverrides(e.Identifier, s)
+	res.Overrides = s.Overrides
+	if s.SrcSHA256 == "" {
+		res.Status = UpgradeFailed
+		res.Reason = "could not compute sha256sum of " + s.SrcURI
+		return res
+	}
+
+	old := cur.Source
+	res.LicenseAdded, res.LicenseRemoved = diffLists(old.Licenses, s.Licenses)
+	unresolved := resolveDepends(s)
+	res.DependsAdded, res.DependsRemoved = diffLists(old.Depends, s.Depends)
+	if len(unresolved) > 0 {
+		utils.Logger.Warn("Upgraded recipe has unresolved dependancies", utils.Logger.Args("recipe", e.Identifier, "depends", strings.Join(unresolved, " ")))
+	}
+
+	if err := rewriteVersionedRecipe(cur, s, res); err != nil {
+		res.Status = UpgradeFailed
+		res.Reason = err.Error()
+		return res
+	}
+	res.Status = UpgradeUpgraded
+	return res
+}
+
+/* rewriteVersionedRecipe renames foo_old.bb to foo_new.bb and updates its
+ * SRC_URI and checksum to the ones the backend gave for the new version.
+ * The .inc, and anything else in the .bb, is left exactly as it was */
+func rewriteVersionedRecipe(cur *RecipeVersion, s *source.RecipeSource, res *UpgradeResult) error {
+	raw, err := os.ReadFile(cur.Path)
+	if err != nil {
+		return err
+	}
+	oldrelease := ""
+	usesrelease := false
+	mapped := false
+	lines := strings.Split(string(raw), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if m := srcurisha.FindStringSubmatch(line); m != nil {
+			lines[i] = srcurisha.ReplaceAllString(line, m[1]+`"`+s.SrcSHA256+`"`)
+			continue
+		}
+		loc := srcuriline.FindStringIndex(line)
+		if loc == nil {
+			continue
+		}
+		/* the value usually continues over lines ending in a backslash,
+		 * up to the closing quote */
+		end := i
+		for end < len(lines)-1 && !strings.Contains(strings.Join(lines[i:end+1], "\n")[loc[1]:], `"`) {
+			end++
+		}
+		block := strings.Join(lines[i:end+1], "\n")
+		value, rest, ok := strings.Cut(block[loc[1]:], `"`)
+		if !ok {
+			return fmt.Errorf("unterminated SRC_URI in %s", cur.Path)
+		}
+		/* only the tarball is replaced, patches and the like are kept */
+		uris := value
+		for _, uri := range strings.Fields(value) {
+			switch {
+			case strings.Contains(uri, "_RELEASE}"):
+				/* the release comes from the shared release include */
+				if s.ReleaseGroup == "" {
+					return errors.New("recipe uses a release include, upgrade it with --release-set")
+				}
+				usesrelease = true
+				oldrelease = cur.Recipe.Get(s.ReleaseVariable())
+				uris = strings.Replace(uris, uri, s.ReleaseSrcURI(), 1)
+				mapped = true
+			case !strings.Contains(uri, "${") && strings.Contains(path.Base(uri), cur.Version):
+				uris = strings.Replace(uris, uri, s.SrcURI, 1)
+				mapped = true
+			}
+		}
+		/* uris hold no newlines, so the block keeps its lines */
+		copy(lines[i:end+1], strings.Split(block[:loc[1]]+uris+`"`+rest, "\n"))
+		i = end
+	}
+	if !mapped {
+		return fmt.Errorf("cannot map SRC_URI of %s to %s", cur.Path, s.SrcURI)
+	}
+	if usesrelease && oldrelease != s.Release {
+		res.releaseGroup = s.ReleaseGroup
+		res.release = s.Release
+		res.releaseVariable = s.ReleaseVariable()
+	}
+
+	layerdir, err := filepath.Abs(viper.GetString("yocto.layerdirectory"))
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(cur.Path)
+	if err != nil {
+		return err
+	}
+	old, err := filepath.Rel(layerdir, abs)
+	if err != nil {
+		return err
+	}
+	pn, _ := bitbake.SplitFileName(path.Base(cur.Path))
+	rel := path.Join(path.Dir(old), fmt.Sprintf("%s_%s.bb", pn, s.Version))
+	if _, err := os.Stat(path.Join(layerdir, rel)); err == nil {
+		return fmt.Errorf("%s already exists", path.Join(layerdir, rel))
+	}
+	res.file = &recipeFile{Path: rel, Content: []byte(strings.Join(lines, "\n")), Replaces: old}
+	res.Path = path.Join(viper.GetString("yocto.layerdirectory"), rel)
+	return nil
+}
+
+/* upgradeReleaseIncludes moves the shared release includes of the groups
+ * whose recipes were upgraded to a new release, and warns about recipes
+ * of the group that were left behind */
+func upgradeReleaseIncludes(results []*UpgradeResult) (files []recipeFile, err error) {
+	moved := make(map[string]*UpgradeResult)
+	upgraded := make(map[string]bool)
+	for _, r := range results {
+		if r.Status == UpgradeUpgraded && r.releaseGroup != "" {
+			moved[r.releaseGroup] = r
+			upgraded[r.Identifier] = true
+		}
+	}
+	for group, r := range moved {
+		rel := ReleaseIncludePath(group)
+		raw, err := os.ReadFile(path.Join(viper.GetString("yocto.layerdirectory"), rel))
+		if err != nil {
+			return nil, err
+		}
+		content := releaseset.ReplaceAllStringFunc(string(raw), func(assign string) string {
+			m := releaseset.FindStringSubmatch(assign)
+			if m[2] != r.releaseVariable {
+				return assign
+			}
+			return m[1] + `"` + r.release + `"`
+		})
+		files = append(files, recipeFile{Path: rel, Content: []byte(content)})
+		utils.Logger.Info("Moving release include", utils.Logger.Args("file", rel, "release", r.release))
+		for _, e := range trackedRecipes() {
+			if upgraded[e.Identifier] {
+				continue
+			}
+			for _, inc := range e.Preferred().Recipe.Includes {
+				if strings.HasSuffix(inc, rel) {
+					utils.Logger.Warn("Recipe still needs upgrading to the new release", utils.Logger.Args("recipe", e.Identifier, "group", group, "release", r.release))
+				}
+			}
+		}
+	}
+	return files, nil
+}
+
+/* diffLists returns what was added to and removed from a list */
+func diffLists(old []string, new []string) (added []string, removed []string) {
+	for _, n := range new {
+		if !contains(old, n) {
+			added = append(added, n)
+		}
+	}
+	for _, o := range old {
+		if !contains(new, o) {
+			removed = append(removed, o)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,277 @@
+package recipe
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/answers"
+	"github.com/Fishwaldo/go-yocto/backends"
+	"github.com/Fishwaldo/go-yocto/mapping"
+	"github.com/Fishwaldo/go-yocto/source"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/pterm/pterm"
+	"github.com/spf13/viper"
+)
+
+/* wizardDecisions are the choices made in the wizard that differ from
+ * what was detected, and so are worth saving for the next run */
+type wizardDecisions struct {
+	Version string
+	Removed []string
+	Mapped  map[string]string
+}
+
+/* runWizard walks through the detected metadata of a recipe, letting the
+ * user pick the version, drop dependancies and map the ones we could not
+ * resolve. The decisions may be saved to the layers overrides and mapping
+ * files, so the next run needs no input. The dependancies that were mapped
+ * to recipes the layers do not have are returned as unresolved */
+func runWizard(b backends.Backend, identifier string, s *source.RecipeSource) (*source.RecipeSource, []string, error) {
+	if !answers.Interactive() {
+		return nil, nil, errors.New("the wizard needs a terminal, it is disabled by --non-interactive and CI")
+	}
+	d := wizardDecisions{Mapped: make(map[string]string)}
+
+	pterm.DefaultSection.Println("Detected metadata for " + identifier)
+	showMetadata(s)
+
+	/* the version, from the tarballs that were published */
+	s, err := wizardVersion(b, identifier, s, &d)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	/* the dependancies, resolving what we can first. Overrides apply
+	 * before resolving, so removals are recorded by the upstream name */
+	upstream := make(map[string]string)
+	names := append([]string(nil), s.Depends...)
+	unresolved := resolveDepends(s)
+	for i, dep := range s.Depends {
+		upstream[dep] = names[i]
+	}
+	if len(s.Depends) > 0 {
+		keep, err := pterm.DefaultInteractiveMultiselect.
+			WithOptions(s.Depends).
+			WithDefaultOptions(s.Depends).
+			WithFilter(false).
+			WithMaxHeight(15).
+			Show("DEPENDS for " + identifier + ", deselect the ones to remove")
+		if err != nil {
+			return nil, nil, err
+		}
+		var depends []string
+		for _, dep := range s.Depends {
+			if contains(keep, dep) {
+				depends = append(depends, dep)
+			} else {
+				d.Removed = append(d.Removed, upstream[dep])
+			}
+		}
+		s.Depends = depends
+	}
+
+	/* anything left unresolved needs mapping to a recipe, or dropping */
+	var missing []string
+	for _, dep := range unresolved {
+		if !contains(s.Depends, dep) {
+			continue
+		}
+		result, err := pterm.DefaultInteractiveTextInput.WithMultiLine(false).Show("Recipe providing " + dep + " (empty to remove it)")
+		if err != nil {
+			return nil, nil, err
+		}
+		result = strings.TrimSpace(result)
+		if result == "" {
+			s.Depends = remove(s.Depends, dep)
+			d.Removed = append(d.Removed, dep)
+			continue
+		}
+		if _, ok := existing.Lookup(result); !ok {
+			pterm.Warning.Println("No recipe " + result + " in the layers, it will have to be created")
+			missing = append(missing, result)
+		}
+		for i := range s.Depends {
+			if s.Depends[i] == dep {
+				s.Depends[i] = result
+			}
+		}
+		d.Mapped[dep] = result
+	}
+
+	if d.empty() {
+		return s, missing, nil
+	}
+	/* a preview shows the answers it would save, rather than saving them */
+	if viper.GetBool("recipe.dryrun") || viper.GetBool("recipe.diff") {
+		if err := d.preview(identifier); err != nil {
+			return nil, nil, err
+		}
+		return s, missing, nil
+	}
+	save, err := pterm.DefaultInteractiveConfirm.WithDefaultValue(true).Show("Save these answers to the layer, so the next run needs no input?")
+	if err != nil {
+		return nil, nil, err
+	}
+	if save {
+		if err := d.save(identifier); err != nil {
+			utils.Logger.Error("Failed to save answers", utils.Logger.Args("recipe", identifier, "error", err))
+			return nil, nil, err
+		}
+	}
+	return s, missing, nil
+}
+
+/* showMetadata prints what was detected for a recipe */
+func showMetadata(s *source.RecipeSource) {
+	td := pterm.TableData{
+		{"Name", s.Name},
+		{"Summary", s.Summary},
+		{"Version", s.Version},
+		{"Section", s.Section},
+		{"Licenses", strings.Join(s.Licenses, " ")},
+		{"Build System", s.BuildSystem},
+		{"Inherits", strings.Join(s.Inherits, " ")},
+		{"Depends", strings.Join(s.Depends, " ")},
+		{"Source", s.SrcURI},
+	}
+	pterm.DefaultTable.WithData(td).Render()
+}
+
+/* wizardVersion offers the released versions of a recipe, newest first,
+ * and fetches the recipe again if another one is picked */
+func wizardVersion(b backends.Backend, identifier string, s *source.RecipeSource, d *wizardDecisions) (*source.RecipeSource, error) {
+	releases, err := b.Releases(identifier)
+	if err != nil {
+		utils.Logger.Warn("No releases to choose from", utils.Logger.Args("recipe", identifier, "error", err))
+		return s, nil
+	}
+	labels := make(map[string]string)
+	var options []string
+	current := ""
+	for i := len(releases) - 1; i >= 0; i-- {
+		r := releases[i]
+		/* a release only announced in AppStream has no tarball to build */
+		if r.Origin == "appstream" {
+			continue
+		}
+		label := r.Version
+		if !r.Date.IsZero() {
+			label += " (" + r.Date.Format("2006-01-02") + ")"
+		}
+		if r.Prerelease {
+			label += " prerelease"
+		}
+		labels[label] = r.Version
+		options = append(options, label)
+		if r.Version == s.Version {
+			current = label
+		}
+	}
+	if len(options) < 2 {
+		return s, nil
+	}
+	sel := pterm.DefaultInteractiveSelect.WithOptions(options).WithMaxHeight(15)
+	if current != "" {
+		sel = sel.WithDefaultOption(current)
+	}
+	result, err := sel.Show("Version of " + identifier)
+	if err != nil {
+		return nil, err
+	}
+	version := labels[result]
+	if version == s.Version {
+		return s, nil
+	}
+	ns, err := b.GetRecipeVersion(identifier, version, singleOptions())
+	if err != nil {
+		utils.Logger.Error("Failed to get Recipe Version", utils.Logger.Args("recipe", identifier, "version", version, "error", err))
+		return nil, err
+	}
+	applyOverrides(identifier, ns)
+	if latest, err := b.LatestVersion(identifier); err != nil || latest != version {
+		d.Version = version
+	}
+	return ns, nil
+}
+
+func (d wizardDecisions) empty() bool {
+	return d.Version == "" && len(d.Removed) == 0 && len(d.Mapped) == 0
+}
+
+/* save records the decisions. Versions and removed dependancies go to the
+ * overrides for the recipe, mapped dependancies to the mapping file of the
+ * layer and, since the backend may name them differently next time, to
+ * the override as well */
+func (d wizardDecisions) save(identifier string) error {
+	o, entries := d.changes()
+	file, err := saveOverride(identifier, o)
+	if err != nil {
+		return err
+	}
+	pterm.Success.Println("Saved overrides for " + identifier + " to " + file)
+	if len(entries) == 0 {
+		return nil
+	}
+	file, err = mapping.SaveLayerMappings(viper.GetString("yocto.layerdirectory"), entries)
+	if err != nil {
+		return err
+	}
+	pterm.Success.Println("Saved dependancy mappings to " + file)
+	return nil
+}
+
+/* changes returns the override and the mapping entries the decisions
+ * amount to */
+func (d wizardDecisions) changes() (Override, map[string]mapping.Entry) {
+	o := Override{Version: d.Version}
+	o.Depends.Remove = append(o.Depends.Remove, d.Removed...)
+	entries := make(map[string]mapping.Entry)
+	var deps []string
+	for dep := range d.Mapped {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+	for _, dep := range deps {
+		o.Depends.Remove = append(o.Depends.Remove, dep)
+		o.Depends.Add = append(o.Depends.Add, d.Mapped[dep])
+		entries[dep] = mapping.Entry{Recipe: d.Mapped[dep]}
+	}
+	return o, entries
+}
+
+/* preview shows the overrides and mapping files as save would write them */
+func (d wizardDecisions) preview(identifier string) error {
+	layerdir := viper.GetString("yocto.layerdirectory")
+	o, entries := d.changes()
+	file, _, content, err := mergeOverride(identifier, o)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(layerdir, file)
+	if err != nil {
+		return err
+	}
+	files := []recipeFile{{Path: rel, Content: content}}
+	if len(entries) > 0 {
+		file, content, err := mapping.MergeLayerMappings(layerdir, entries)
+		if err != nil {
+			return err
+		}
+		if rel, err = filepath.Rel(layerdir, file); err != nil {
+			return err
+		}
+		files = append(files, recipeFile{Path: rel, Content: content})
+	}
+	return previewRecipeFiles(files)
+}
+
+func remove(list []string, item string) (result []string) {
+	for _, v := range list {
+		if v != item {
+			result = append(result, v)
+		}
+	}
+	return result
+}
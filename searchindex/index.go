@@ -0,0 +1,344 @@
+package searchindex
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Fishwaldo/go-yocto/source"
+	"github.com/Fishwaldo/go-yocto/utils"
+)
+
+/* formatVersion changes whenever the file layout does, an index of another
+ * version has to be rebuilt */
+const formatVersion = 1
+
+/* how much each kind of lookup of a term counts, in tenths of the weight
+ * stored for it */
+const (
+	lookupExact  = 10
+	lookupPrefix = 6
+	lookupFuzzy  = 3
+)
+
+/* ErrNoIndex is returned when there is no usable index on disk */
+var ErrNoIndex = errors.New("no search index, run cache update")
+
+/* entry is what is kept of a source, enough to filter and show it */
+type entry struct {
+	Name        string
+	Identifier  string
+	Description string
+	Summary     string
+	Section     string
+	Backend     string
+	Url         string
+	Topics      []string
+	Groups      []string
+	Active      bool
+}
+
+/* posting is a source a term was found in, and the weight of the best
+ * field it was found in */
+type posting struct {
+	Doc    uint32
+	Weight uint16
+}
+
+/* Index is an inverted index over the sources of every backend. Terms and
+ * Grams are sorted, so they are found, and prefixes expanded, by binary
+ * search. Grams index the identifier and name of each source, to find
+ * them by a part that is not a word */
+type Index struct {
+	Version      int
+	Built        time.Time
+	Entries      []entry
+	Terms        []string
+	Postings     [][]posting
+	Grams        []string
+	GramPostings [][]uint32
+}
+
+/* File returns where the index is kept, next to the backend caches */
+func File() string {
+	return filepath.Join(utils.Config.BaseDir, "search-index.gob")
+}
+
+/* Build indexes the documents the backends fed us */
+func Build(docs []source.Document) *Index {
+	terms := make(map[string]map[uint32]uint16)
+	add := func(term string, doc uint32, weight int) {
+		if term == "" {
+			return
+		}
+		p, ok := terms[term]
+		if !ok {
+			p = make(map[uint32]uint16)
+			terms[term] = p
+		}
+		if uint16(weight) > p[doc] {
+			p[doc] = uint16(weight)
+		}
+	}
+	gramdocs := make(map[string][]uint32)
+	/* short values count whole and by their words and stems */
+	field := func(doc uint32, value string, weight int) {
+		value = strings.ToLower(strings.TrimSpace(value))
+		add(value, doc, weight*source.MatchExact)
+		for _, w := range words(value) {
+			add(w, doc, weight*source.MatchWord)
+			add(stem(w), doc, weight*source.MatchWord)
+		}
+	}
+
+	ix := &Index{Version: formatVersion, Built: time.Now()}
+	for i, d := range docs {
+		doc := uint32(i)
+		summary := d.Source.Summary
+		if summary == "" {
+			summary = d.Summary
+		}
+		ix.Entries = append(ix.Entries, entry{
+			Name:        d.Source.Name,
+			Identifier:  d.Source.Identifier,
+			Description: d.Source.Description,
+			Summary:     summary,
+			Section:     d.Source.Section,
+			Backend:     d.Source.BackendID,
+			Url:         d.Source.Url,
+			Topics:      d.Topics,
+			Groups:      d.Groups,
+			Active:      d.Active,
+		})
+		field(doc, d.Source.Identifier, source.WeightIdentifier)
+		field(doc, d.Source.Name, source.WeightName)
+		for _, t := range d.Topics {
+			field(doc, t, source.WeightTopic)
+		}
+		/* long text only counts by its words */
+		for _, w := range words(summary) {
+			add(stem(w), doc, source.WeightSummary*source.MatchWord)
+		}
+		for _, w := range words(d.Source.Description) {
+			add(stem(w), doc, source.WeightDescription*source.MatchWord)
+		}
+		seen := make(map[string]bool)
+		for _, v := range []string{d.Source.Identifier, d.Source.Name} {
+			for _, g := range grams(strings.ToLower(v)) {
+				if !seen[g] {
+					seen[g] = true
+					gramdocs[g] = append(gramdocs[g], doc)
+				}
+			}
+		}
+	}
+
+	for t := range terms {
+		ix.Terms = append(ix.Terms, t)
+	}
+	sort.Strings(ix.Terms)
+	for _, t := range ix.Terms {
+		var p []posting
+		for doc, w := range terms[t] {
+			p = append(p, posting{Doc: doc, Weight: w})
+		}
+		sort.Slice(p, func(a, b int) bool { return p[a].Doc < p[b].Doc })
+		ix.Postings = append(ix.Postings, p)
+	}
+	for g := range gramdocs {
+		ix.Grams = append(ix.Grams, g)
+	}
+	sort.Strings(ix.Grams)
+	for _, g := range ix.Grams {
+		ix.GramPostings = append(ix.GramPostings, gramdocs[g])
+	}
+	return ix
+}
+
+/* Save writes the index, replacing the old one only once it is complete */
+func (ix *Index) Save(file string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".search-index-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := gob.NewEncoder(tmp).Encode(ix); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+/* Load reads the index. A missing or outdated index is ErrNoIndex */
+func Load(file string) (*Index, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNoIndex
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var ix Index
+	if err := gob.NewDecoder(f).Decode(&ix); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if ix.Version != formatVersion {
+		utils.Logger.Warn("Search index is from another version", utils.Logger.Args("file", file, "version", ix.Version))
+		return nil, ErrNoIndex
+	}
+	return &ix, nil
+}
+
+/* lookup scores the sources a single query term matches, into scores
+ * indexed by source. Exact terms and stems count most, then terms it is a
+ * prefix of, then identifiers and names that contain it. Only a term that
+ * matched nothing is looked for a typo or two away */
+func (ix *Index) lookup(term string, scores []int) {
+	found := false
+	hit := func(i int, kind int) {
+		for _, p := range ix.Postings[i] {
+			if s := int(p.Weight) * kind / 10; s > scores[p.Doc] {
+				scores[p.Doc] = s
+			}
+		}
+		found = true
+	}
+	for _, t := range []string{term, stem(term)} {
+		if i := sort.SearchStrings(ix.Terms, t); i < len(ix.Terms) && ix.Terms[i] == t {
+			hit(i, lookupExact)
+		}
+	}
+	for i := sort.SearchStrings(ix.Terms, term); i < len(ix.Terms) && strings.HasPrefix(ix.Terms[i], term); i++ {
+		if ix.Terms[i] != term {
+			hit(i, lookupPrefix)
+		}
+	}
+	for _, doc := range ix.contains(term) {
+		e := ix.Entries[doc]
+		s := 0
+		if strings.Contains(strings.ToLower(e.Identifier), term) {
+			s = source.WeightIdentifier * source.MatchSubstring
+		} else if strings.Contains(strings.ToLower(e.Name), term) {
+			s = source.WeightName * source.MatchSubstring
+		}
+		if s > scores[doc] {
+			scores[doc] = s
+		}
+		found = found || s > 0
+	}
+	if found {
+		return
+	}
+	if maxdist := source.MaxTypos(term); maxdist > 0 {
+		for i, t := range ix.Terms {
+			if d := len(t) - len(term); d > maxdist || d < -maxdist {
+				continue
+			}
+			if source.Distance(term, t) <= maxdist {
+				hit(i, lookupFuzzy)
+			}
+		}
+	}
+}
+
+/* contains returns the sources whose identifier or name may contain term,
+ * those that have all of its grams */
+func (ix *Index) contains(term string) (docs []uint32) {
+	g := grams(term)
+	if len(g) == 0 {
+		return nil
+	}
+	for n, gram := range g {
+		i := sort.SearchStrings(ix.Grams, gram)
+		if i == len(ix.Grams) || ix.Grams[i] != gram {
+			return nil
+		}
+		if n == 0 {
+			docs = append(docs, ix.GramPostings[i]...)
+			continue
+		}
+		docs = intersect(docs, ix.GramPostings[i])
+	}
+	return docs
+}
+
+/* intersect two sorted lists of sources */
+func intersect(a []uint32, b []uint32) (result []uint32) {
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+/* Search runs a query against the index. Every term has to match, and
+ * the filters of the query apply as they do for a backend */
+func (ix *Index) Search(q source.Query) (matches []source.Match) {
+	total := make([]int, len(ix.Entries))
+	matched := make([]bool, len(ix.Entries))
+	for i := range matched {
+		matched[i] = true
+	}
+	scores := make([]int, len(ix.Entries))
+	for _, term := range q.Terms() {
+		for i := range scores {
+			scores[i] = 0
+		}
+		ix.lookup(term, scores)
+		for i, s := range scores {
+			if s == 0 {
+				matched[i] = false
+			}
+			total[i] += s
+		}
+	}
+	for doc, ok := range matched {
+		if !ok {
+			continue
+		}
+		e := ix.Entries[doc]
+		if q.Backend != "" && e.Backend != q.Backend {
+			continue
+		}
+		d := e.document()
+		if !q.Filter(d) {
+			continue
+		}
+		matches = append(matches, source.Match{Source: d.Source, Score: total[doc]})
+	}
+	return matches
+}
+
+func (e entry) document() source.Document {
+	return source.Document{
+		Source: source.RecipeSource{
+			Name:        e.Name,
+			Identifier:  e.Identifier,
+			Description: e.Description,
+			Summary:     e.Summary,
+			Section:     e.Section,
+			BackendID:   e.Backend,
+			Url:         e.Url,
+		},
+		Topics: e.Topics,
+		Groups: e.Groups,
+		Active: e.Active,
+	}
+}
@@ -0,0 +1,74 @@
+package searchindex
+
+import (
+	"strings"
+	"unicode"
+)
+
+/* words splits text into lower case words */
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+/* gramSize is the length of the grams names are indexed by, so they can
+ * be found by any part, eg addons in kcoreaddons */
+const gramSize = 3
+
+/* grams returns the distinct grams of a lower case value */
+func grams(value string) (g []string) {
+	r := []rune(value)
+	seen := make(map[string]bool)
+	for i := 0; i+gramSize <= len(r); i++ {
+		if s := string(r[i : i+gramSize]); !seen[s] {
+			seen[s] = true
+			g = append(g, s)
+		}
+	}
+	return g
+}
+
+/* english suffixes we strip, longest first. One is replaced so related
+ * words meet, eg organization and organize */
+var stemSuffixes = []struct {
+	suffix  string
+	replace string
+}{
+	{"ational", ""},
+	{"ization", "ize"},
+	{"ations", ""},
+	{"ation", ""},
+	{"ments", ""},
+	{"ment", ""},
+	{"ings", ""},
+	{"ing", ""},
+	{"ies", "y"},
+	{"ers", ""},
+	{"ors", ""},
+	{"er", ""},
+	{"or", ""},
+	{"es", ""},
+	{"ed", ""},
+	{"ly", ""},
+	{"s", ""},
+}
+
+/* stem reduces a word to a crude stem, so manager, managing and manages
+ * all match manage. It is light on purpose, names are not english and
+ * both the index and the query are stemmed the same way */
+func stem(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+	for _, s := range stemSuffixes {
+		if strings.HasSuffix(word, s.suffix) && len(word)-len(s.suffix)+len(s.replace) >= 3 {
+			word = strings.TrimSuffix(word, s.suffix) + s.replace
+			break
+		}
+	}
+	if len(word) > 3 {
+		word = strings.TrimSuffix(word, "e")
+	}
+	return word
+}
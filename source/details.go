@@ -0,0 +1,32 @@
+package source
+
+/* Details is everything a backend knows about a source, for source show.
+ * Details come from the caches, except Licenses, which a backend fetches
+ * over the network and only when asked to */
+type Details struct {
+	Name                 string     `json:"name" yaml:"name"`
+	Identifier           string     `json:"identifier" yaml:"identifier"`
+	Backend              string     `json:"backend" yaml:"backend"`
+	Description          string     `json:"description" yaml:"description"`
+	URL                  string     `json:"url" yaml:"url"`
+	Repopath             string     `json:"repopath" yaml:"repopath"`
+	Active               bool       `json:"active" yaml:"active"`
+	Branch               string     `json:"branch" yaml:"branch"`
+	Topics               []string   `json:"topics" yaml:"topics"`
+	Summary              string     `json:"appstream_summary,omitempty" yaml:"appstream_summary,omitempty"`
+	AppStreamDescription string     `json:"appstream_description,omitempty" yaml:"appstream_description,omitempty"`
+	Releases             []Release  `json:"releases" yaml:"releases"`
+	Downloads            []Download `json:"downloads" yaml:"downloads"`
+	Depends              []string   `json:"depends" yaml:"depends"`
+	ReverseDepends       []string   `json:"reverse_depends" yaml:"reverse_depends"`
+	Licenses             []string   `json:"licenses,omitempty" yaml:"licenses,omitempty"`
+	Bugzilla             string     `json:"bugzilla,omitempty" yaml:"bugzilla,omitempty"`
+}
+
+/* Download is a tarball of a source */
+type Download struct {
+	Version    string `json:"version" yaml:"version"`
+	URL        string `json:"url" yaml:"url"`
+	Date       string `json:"date,omitempty" yaml:"date,omitempty"`
+	Prerelease bool   `json:"prerelease" yaml:"prerelease"`
+}
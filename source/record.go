@@ -0,0 +1,52 @@
+package source
+
+/* Record is the machine readable form of a RecipeSource, for --output json
+ * and yaml. Its field names are part of our interface, so fields may be
+ * added but never renamed */
+type Record struct {
+	Name               string     `json:"name" yaml:"name"`
+	Identifier         string     `json:"identifier" yaml:"identifier"`
+	Backend            string     `json:"backend" yaml:"backend"`
+	Description        string     `json:"description" yaml:"description"`
+	Summary            string     `json:"summary" yaml:"summary"`
+	Version            string     `json:"version" yaml:"version"`
+	URL                string     `json:"url" yaml:"url"`
+	Section            string     `json:"section" yaml:"section"`
+	Licenses           []string   `json:"licenses" yaml:"licenses"`
+	Inherits           []string   `json:"inherits" yaml:"inherits"`
+	Depends            []string   `json:"depends" yaml:"depends"`
+	BuildSystem        string     `json:"build_system" yaml:"build_system"`
+	SrcURI             string     `json:"src_uri" yaml:"src_uri"`
+	SrcSHA256          string     `json:"src_sha256" yaml:"src_sha256"`
+	ReleaseGroup       string     `json:"release_group,omitempty" yaml:"release_group,omitempty"`
+	Release            string     `json:"release,omitempty" yaml:"release,omitempty"`
+	UpstreamCheckURI   string     `json:"upstream_check_uri,omitempty" yaml:"upstream_check_uri,omitempty"`
+	UpstreamCheckRegex string     `json:"upstream_check_regex,omitempty" yaml:"upstream_check_regex,omitempty"`
+	Variables          []Variable `json:"variables,omitempty" yaml:"variables,omitempty"`
+}
+
+/* Record returns the machine readable form of the source. Lists are never
+ * null, so consumers need not check */
+func (s RecipeSource) Record() Record {
+	return Record{
+		Name:               s.Name,
+		Identifier:         s.Identifier,
+		Backend:            s.BackendID,
+		Description:        s.Description,
+		Summary:            s.Summary,
+		Version:            s.Version,
+		URL:                s.Url,
+		Section:            s.Section,
+		Licenses:           append([]string{}, s.Licenses...),
+		Inherits:           append([]string{}, s.Inherits...),
+		Depends:            append([]string{}, s.Depends...),
+		BuildSystem:        s.BuildSystem,
+		SrcURI:             s.SrcURI,
+		SrcSHA256:          s.SrcSHA256,
+		ReleaseGroup:       s.ReleaseGroup,
+		Release:            s.Release,
+		UpstreamCheckURI:   s.UpstreamCheckURI,
+		UpstreamCheckRegex: s.UpstreamCheckRegex,
+		Variables:          s.Variables,
+	}
+}
@@ -0,0 +1,269 @@
+package source
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+/* Query is a search for sources. Every keyword has to match one of the
+ * searched fields, closely enough, and every filter that is set has to
+ * match */
+type Query struct {
+	Keywords   string
+	Backend    string
+	Section    string
+	Topic      string
+	ActiveOnly bool
+	Limit      int
+	Sort       string
+}
+
+/* the orders results can be sorted in */
+const (
+	SortScore      = "score"
+	SortName       = "name"
+	SortIdentifier = "identifier"
+	SortBackend    = "backend"
+)
+
+/* Document is what a backend knows about a source that can be searched */
+type Document struct {
+	Source  RecipeSource
+	Summary string
+	Topics  []string
+	Groups  []string
+	Active  bool
+}
+
+/* Match is a source found by a search and how well it matched */
+type Match struct {
+	Source RecipeSource
+	Score  int
+}
+
+/* how much a match in each field counts, for the search index too */
+const (
+	WeightIdentifier  = 10
+	WeightName        = 10
+	WeightTopic       = 6
+	WeightSummary     = 4
+	WeightDescription = 2
+)
+
+/* how much each kind of match counts */
+const (
+	MatchExact     = 10
+	MatchWord      = 6
+	MatchSubstring = 4
+	MatchFuzzy     = 2
+)
+
+/* Terms splits the keywords of a query into lower case terms */
+func (q Query) Terms() []string {
+	return strings.Fields(strings.ToLower(q.Keywords))
+}
+
+/* Filter reports if a document passes the filters of the query */
+func (q Query) Filter(d Document) bool {
+	if q.ActiveOnly && !d.Active {
+		return false
+	}
+	if q.Section != "" {
+		found := strings.EqualFold(d.Source.Section, q.Section)
+		for _, g := range d.Groups {
+			found = found || strings.EqualFold(g, q.Section)
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Topic != "" {
+		found := false
+		for _, t := range d.Topics {
+			found = found || strings.EqualFold(t, q.Topic)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+/* Score ranks a document against the query. A document fails to match if
+ * a filter fails or a keyword matches none of its fields. With no keywords
+ * everything that passes the filters matches, with a score of 0 */
+func (q Query) Score(d Document) (score int, ok bool) {
+	if !q.Filter(d) {
+		return 0, false
+	}
+	summary := d.Source.Summary
+	if summary == "" {
+		summary = d.Summary
+	}
+	fields := []struct {
+		weight int
+		values []string
+	}{
+		{WeightIdentifier, []string{d.Source.Identifier}},
+		{WeightName, []string{d.Source.Name}},
+		{WeightTopic, d.Topics},
+		{WeightSummary, []string{summary}},
+		{WeightDescription, []string{d.Source.Description}},
+	}
+	for _, term := range q.Terms() {
+		best := 0
+		for _, f := range fields {
+			for _, v := range f.values {
+				if s := f.weight * matchKind(term, strings.ToLower(v)); s > best {
+					best = s
+				}
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		score += best
+	}
+	return score, true
+}
+
+/* matchKind returns how well a term matches a lower case value, or 0 */
+func matchKind(term string, value string) int {
+	if value == "" {
+		return 0
+	}
+	if value == term {
+		return MatchExact
+	}
+	words := strings.FieldsFunc(value, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if w == term {
+			return MatchWord
+		}
+	}
+	if strings.Contains(value, term) {
+		return MatchSubstring
+	}
+	maxdist := MaxTypos(term)
+	if maxdist == 0 {
+		return 0
+	}
+	for _, w := range words {
+		if abs(len(w)-len(term)) > maxdist {
+			continue
+		}
+		if Distance(term, w) <= maxdist {
+			return MatchFuzzy
+		}
+	}
+	return 0
+}
+
+/* MaxTypos is how many typos are forgiven in a term, more of them in
+ * longer terms and none in short ones */
+func MaxTypos(term string) int {
+	switch {
+	case len(term) >= 8:
+		return 2
+	case len(term) >= 4:
+		return 1
+	}
+	return 0
+}
+
+/* Distance is the Damerau-Levenshtein (optimal string alignment) edit
+ * distance, so a transposition counts as one typo */
+func Distance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func min(v int, vs ...int) int {
+	for _, x := range vs {
+		if x < v {
+			v = x
+		}
+	}
+	return v
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+/* Rank drops duplicate matches, keeping the best scoring one, then sorts
+ * and limits them as the query asks. Ties are broken by name so results
+ * are stable */
+func (q Query) Rank(matches []Match) []Match {
+	best := make(map[string]int)
+	var ranked []Match
+	for _, m := range matches {
+		key := m.Source.BackendID + "\x00" + m.Source.Identifier
+		if i, ok := best[key]; ok {
+			if m.Score > ranked[i].Score {
+				ranked[i] = m
+			}
+			continue
+		}
+		best[key] = len(ranked)
+		ranked = append(ranked, m)
+	}
+	byName := func(a, b Match) bool {
+		if a.Source.Name != b.Source.Name {
+			return a.Source.Name < b.Source.Name
+		}
+		if a.Source.Identifier != b.Source.Identifier {
+			return a.Source.Identifier < b.Source.Identifier
+		}
+		return a.Source.BackendID < b.Source.BackendID
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		switch q.Sort {
+		case SortName:
+		case SortIdentifier:
+			if a.Source.Identifier != b.Source.Identifier {
+				return a.Source.Identifier < b.Source.Identifier
+			}
+		case SortBackend:
+			if a.Source.BackendID != b.Source.BackendID {
+				return a.Source.BackendID < b.Source.BackendID
+			}
+		default:
+			if a.Score != b.Score {
+				return a.Score > b.Score
+			}
+		}
+		return byName(a, b)
+	})
+	if q.Limit > 0 && len(ranked) > q.Limit {
+		ranked = ranked[:q.Limit]
+	}
+	return ranked
+}
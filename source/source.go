@@ -1,5 +1,10 @@
 package source
 
+import (
+	"strings"
+	"time"
+)
+
 type RecipeSource struct {
 	Name string
 	Identifier string
@@ -15,5 +20,53 @@ type RecipeSource struct {
 	SrcSHA256 string
 	Licenses []string
 	Location string
+	ReleaseGroup string
+	Release string
+	UpstreamCheckURI string
+	UpstreamCheckRegex string
+	BuildSystem string
+	Variables []Variable
+	/* Overrides are the layer overrides that were applied, by key */
+	Overrides []string
+}
+
+/* Variable is an extra BitBake variable to set in the recipe */
+type Variable struct {
+	Name  string `json:"name" yaml:"name"`
+	Value string `json:"value" yaml:"value"`
+}
+
+/* Options tune how a backend gets a recipe */
+type Options struct {
+	/* Interactive allows prompting for values missing upstream */
+	Interactive bool
+	/* Quiet turns off spinners, for recipes that are got concurrently */
+	Quiet bool
 }
 
+/* Release is a published version of a source */
+type Release struct {
+	Version    string    `json:"version" yaml:"version"`
+	Date       time.Time `json:"date,omitempty" yaml:"date,omitempty"`
+	Prerelease bool      `json:"prerelease" yaml:"prerelease"`
+	Origin     string    `json:"origin" yaml:"origin"`
+	Announced  time.Time `json:"announced,omitempty" yaml:"announced,omitempty"`
+}
+
+/* ReleaseVariable is the BitBake variable holding the release of the
+ * recipes release group, eg KDE_FRAMEWORKS_RELEASE */
+func (s RecipeSource) ReleaseVariable() string {
+	if s.ReleaseGroup == "" {
+		return ""
+	}
+	return strings.ToUpper(strings.ReplaceAll(s.ReleaseGroup, "-", "_")) + "_RELEASE"
+}
+
+/* ReleaseSrcURI returns SrcURI with the release directory replaced by a
+ * reference to ReleaseVariable, so the shared include moves the group */
+func (s RecipeSource) ReleaseSrcURI() string {
+	if s.ReleaseGroup == "" {
+		return s.SrcURI
+	}
+	return strings.Replace(s.SrcURI, "/"+s.Release+"/", "/${"+s.ReleaseVariable()+"}/", 1)
+}
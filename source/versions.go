@@ -0,0 +1,52 @@
+package source
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+/* IsConstraint reports if a version is a constraint on versions, such as
+ * ~5.104 or >= 23.04, rather than a version */
+func IsConstraint(version string) bool {
+	if strings.ContainsAny(version, "~^<>=*|, ") {
+		return true
+	}
+	return strings.HasSuffix(version, ".x") || strings.HasSuffix(version, ".X")
+}
+
+/* prereleaseconstraint matches a constraint that names a prerelease, such
+ * as >= 5.27.90-0, rather than a hyphen range such as 5.26 - 5.27 */
+var prereleaseconstraint = regexp.MustCompile(`[0-9]-[0-9A-Za-z]`)
+
+/* SelectVersion returns the newest release that satisfies a constraint.
+ * As with semver, prereleases only satisfy a constraint that names one.
+ * Backends mark unstable releases that use plain version numbers, such as
+ * the KDE betas, as prereleases too, so those are skipped the same way */
+func SelectVersion(releases []Release, constraint string) (Release, error) {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return Release{}, err
+	}
+	unstable := prereleaseconstraint.MatchString(constraint)
+	var best Release
+	var bestv *semver.Version
+	for _, r := range releases {
+		if r.Prerelease && !unstable {
+			continue
+		}
+		v, err := semver.NewVersion(r.Version)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if bestv == nil || v.GreaterThan(bestv) {
+			best, bestv = r, v
+		}
+	}
+	if bestv == nil {
+		return Release{}, errors.New("no release matches " + constraint)
+	}
+	return best, nil
+}
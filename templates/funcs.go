@@ -0,0 +1,113 @@
+package templates
+
+import (
+	"sort"
+	"strings"
+	"text/template"
+)
+
+/* the column BitBake style continuation lines are wrapped at */
+const wrapWidth = 80
+
+/* Funcs are the functions available to every template */
+var Funcs = template.FuncMap{
+	"join":    strings.Join,
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"escape":  Escape,
+	"quote":   Quote,
+	"wrap":    Wrap,
+	"bblist":  BBList,
+	"license": License,
+}
+
+/* Escape escapes a value for use inside a double quoted BitBake string */
+func Escape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	/* BitBake values are a single line, unless continued */
+	return strings.Join(strings.Fields(s), " ")
+}
+
+/* Quote returns a value as a double quoted BitBake string */
+func Quote(s string) string {
+	return `"` + Escape(s) + `"`
+}
+
+/* Wrap returns a long value as a quoted BitBake string, continued over
+ * several lines so none is longer than width. A width of 0 wraps at 80
+ * columns */
+func Wrap(width int, s string) string {
+	if width <= 0 {
+		width = wrapWidth
+	}
+	words := strings.Fields(Escape(s))
+	if len(strings.Join(words, " "))+2 <= width {
+		return Quote(s)
+	}
+	var lines []string
+	line := ""
+	for _, w := range words {
+		if line != "" && len(line)+len(w)+7 > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += w
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return "\" \\\n    " + strings.Join(lines, " \\\n    ") + " \\\n\""
+}
+
+/* BBList returns a list as a quoted BitBake string with one item per line,
+ * as used for DEPENDS and RDEPENDS */
+func BBList(items []string) string {
+	if len(items) == 0 {
+		return `""`
+	}
+	var b strings.Builder
+	b.WriteString("\" \\\n")
+	for _, i := range items {
+		b.WriteString("    " + i + " \\\n")
+	}
+	b.WriteString("\"")
+	return b.String()
+}
+
+/* License formats licenses as a BitBake license expression. Each license
+ * may be an SPDX expression itself, whose AND and OR become & and |.
+ * Duplicates are dropped and the licenses sorted, so the expression is
+ * stable */
+func License(licenses []string) string {
+	seen := make(map[string]bool)
+	var exprs []string
+	for _, l := range licenses {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		fields := strings.Fields(l)
+		for i, f := range fields {
+			switch strings.ToUpper(f) {
+			case "AND":
+				fields[i] = "&"
+			case "OR":
+				fields[i] = "|"
+			}
+		}
+		l = strings.Join(fields, " ")
+		if len(fields) > 1 {
+			l = "(" + l + ")"
+		}
+		if !seen[l] {
+			seen[l] = true
+			exprs = append(exprs, l)
+		}
+	}
+	sort.Strings(exprs)
+	return strings.Join(exprs, " & ")
+}
@@ -0,0 +1,85 @@
+package templates
+
+import (
+	_ "embed"
+	"path"
+	"strings"
+
+	"github.com/Fishwaldo/go-yocto/source"
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultMain    = "recipe-main"
+	DefaultInclude = "recipe-include"
+)
+
+/* Rule picks the templates for the recipes it matches. Each of Backend,
+ * BuildSystem, Section and Identifier is a glob, and an empty one matches
+ * anything. An empty Main or Include keeps the default template */
+type Rule struct {
+	Backend     string `yaml:"backend,omitempty" mapstructure:"backend"`
+	BuildSystem string `yaml:"buildsystem,omitempty" mapstructure:"buildsystem"`
+	Section     string `yaml:"section,omitempty" mapstructure:"section"`
+	Identifier  string `yaml:"identifier,omitempty" mapstructure:"identifier"`
+	Main        string `yaml:"main,omitempty" mapstructure:"main"`
+	Include     string `yaml:"include,omitempty" mapstructure:"include"`
+}
+
+type rulesFile struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+//go:embed rules.yaml
+var builtinrules []byte
+
+/* Rules returns the template selection rules, user rules first */
+func Rules() (rules []Rule) {
+	var user []Rule
+	if err := viper.UnmarshalKey("templates.rules", &user); err != nil {
+		utils.Logger.Error("Failed to read template rules", utils.Logger.Args("error", err))
+	}
+	rules = append(rules, user...)
+	var def rulesFile
+	if err := yaml.Unmarshal(builtinrules, &def); err != nil {
+		utils.Logger.Error("Failed to unmarshal builtin template rules", utils.Logger.Args("error", err))
+	}
+	return append(rules, def.Rules...)
+}
+
+func matchGlob(pattern string, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(value))
+	return ok
+}
+
+/* Matches reports if a rule applies to a recipe */
+func (r Rule) Matches(s *source.RecipeSource) bool {
+	return matchGlob(r.Backend, s.BackendID) &&
+		matchGlob(r.BuildSystem, s.BuildSystem) &&
+		matchGlob(r.Section, s.Section) &&
+		matchGlob(r.Identifier, s.Identifier)
+}
+
+/* Select returns the main and include templates to render a recipe with */
+func Select(s *source.RecipeSource) (main string, include string) {
+	main, include = DefaultMain, DefaultInclude
+	for _, r := range Rules() {
+		if !r.Matches(s) {
+			continue
+		}
+		utils.Logger.Trace("Template rule matched", utils.Logger.Args("recipe", s.Identifier, "main", r.Main, "include", r.Include))
+		if r.Main != "" {
+			main = r.Main
+		}
+		if r.Include != "" {
+			include = r.Include
+		}
+		break
+	}
+	return main, include
+}
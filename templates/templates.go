@@ -0,0 +1,155 @@
+package templates
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Fishwaldo/go-yocto/utils"
+	"github.com/spf13/viper"
+)
+
+/* File is a template found on the search path */
+type File struct {
+	Name   string
+	Path   string
+	Origin string
+}
+
+/* Entry is a template name, the file that wins and the files it shadows */
+type Entry struct {
+	File
+	Partial  bool
+	Shadowed []File
+}
+
+//go:embed *.tmpl
+var builtin embed.FS
+
+func init() {
+	viper.SetDefault("templates.userdir", "$HOME/.config/go-yocto/templates")
+	viper.SetDefault("templates.layerdir", "templates")
+}
+
+type searchDir struct {
+	origin string
+	fsys   fs.FS
+	dir    string
+}
+
+/* searchPath returns where templates are looked for, lowest precedence
+ * first: the builtin templates, the user config dir, the templates dir of
+ * the layer, each followed by its subdirectory for the backend */
+func searchPath(backend string) (dirs []searchDir) {
+	dirs = append(dirs, searchDir{origin: "builtin", fsys: builtin, dir: "builtin:"})
+	var roots []searchDir
+	if user := os.ExpandEnv(viper.GetString("templates.userdir")); user != "" {
+		roots = append(roots, searchDir{origin: "user", dir: user})
+	}
+	if layerdir := viper.GetString("templates.layerdir"); layerdir != "" {
+		if !filepath.IsAbs(layerdir) {
+			layerdir = filepath.Join(viper.GetString("yocto.layerdirectory"), layerdir)
+		}
+		roots = append(roots, searchDir{origin: "layer", dir: layerdir})
+	}
+	for _, r := range roots {
+		dirs = append(dirs, searchDir{origin: r.origin, fsys: os.DirFS(r.dir), dir: r.dir})
+		if backend != "" {
+			bdir := filepath.Join(r.dir, backend)
+			dirs = append(dirs, searchDir{origin: r.origin + "/" + backend, fsys: os.DirFS(bdir), dir: bdir})
+		}
+	}
+	return dirs
+}
+
+/* IsPartial reports if a template file is a shared partial. Partials are
+ * named _name.tmpl and used as {{template "name" .}} */
+func IsPartial(name string) bool {
+	return strings.HasPrefix(name, "_")
+}
+
+func partialName(name string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(name, "_"), ".tmpl")
+}
+
+/* List returns every template on the search path for backend, and which
+ * file is used for it */
+func List(backend string) (entries []Entry) {
+	found := make(map[string]*Entry)
+	var names []string
+	for _, d := range searchPath(backend) {
+		matches, err := fs.Glob(d.fsys, "*.tmpl")
+		if err != nil {
+			continue
+		}
+		for _, m := range matches {
+			f := File{Name: m, Path: path.Join(d.dir, m), Origin: d.origin}
+			if d.origin == "builtin" {
+				f.Path = "builtin:" + m
+			}
+			e, ok := found[m]
+			if !ok {
+				found[m] = &Entry{File: f, Partial: IsPartial(m)}
+				names = append(names, m)
+				continue
+			}
+			e.Shadowed = append([]File{e.File}, e.Shadowed...)
+			e.File = f
+		}
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		entries = append(entries, *found[n])
+	}
+	return entries
+}
+
+/* Lookup returns the entry for a single template */
+func Lookup(name string, backend string) (Entry, bool) {
+	if !strings.HasSuffix(name, ".tmpl") {
+		name += ".tmpl"
+	}
+	for _, e := range List(backend) {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+/* Read returns the content of the winning file for a template */
+func Read(name string, backend string) ([]byte, error) {
+	e, ok := Lookup(name, backend)
+	if !ok {
+		return nil, errors.New("template " + name + " not found")
+	}
+	if e.Origin == "builtin" {
+		return builtin.ReadFile(e.Name)
+	}
+	return os.ReadFile(e.Path)
+}
+
+/* AddPartials parses every partial on the search path into t, so the
+ * templates can share them */
+func AddPartials(t *template.Template, backend string) error {
+	for _, e := range List(backend) {
+		if !e.Partial {
+			continue
+		}
+		content, err := Read(e.Name, backend)
+		if err != nil {
+			return err
+		}
+		if _, err := t.New(partialName(e.Name)).Parse(string(content)); err != nil {
+			utils.Logger.Error("Failed to parse partial", utils.Logger.Args("template", e.Path, "error", err))
+			return err
+		}
+	}
+	return nil
+}